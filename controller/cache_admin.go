@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCacheKeysLimit = 20
+	maxCacheKeysLimit     = 1000
+)
+
+// CacheKeys 分页查看缓存键
+// 本地缓存使用 offset、limit 分页；redis缓存使用 cursor、limit 游标分页
+func CacheKeys(c *gin.Context) {
+	prefix := c.Query("prefix")
+	limit, ok := queryInt(c, "limit", defaultCacheKeysLimit)
+	if !ok {
+		return
+	}
+	if limit <= 0 || limit > maxCacheKeysLimit {
+		abortWithError(c, http.StatusBadRequest, fmt.Sprintf("limit must in (0, %d]", maxCacheKeysLimit))
+		return
+	}
+
+	switch tier := c.DefaultQuery("tier", utils.CacheTierLocal); tier {
+	case utils.CacheTierLocal:
+		offset, ok := queryInt(c, "offset", 0)
+		if !ok {
+			return
+		}
+		keys, total, err := utils.LocalCacheKeys(prefix, offset, limit)
+		if err != nil {
+			renderCacheError(c, err)
+			return
+		}
+		renderData(c, gin.H{"keys": keys, "total": total})
+	case utils.CacheTierRedis:
+		cursor, err := strconv.ParseUint(c.DefaultQuery("cursor", "0"), 10, 64)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, "cursor must be an unsigned integer")
+			return
+		}
+		keys, next, err := utils.RedisCacheKeys(c.Request.Context(), prefix, cursor, int64(limit))
+		if err != nil {
+			renderCacheError(c, err)
+			return
+		}
+		renderData(c, gin.H{"keys": keys, "cursor": next})
+	default:
+		abortUnknownTier(c, tier)
+	}
+}
+
+// CacheKey 查看缓存键的大小与剩余有效期
+func CacheKey(c *gin.Context) {
+	key, ok := requiredQuery(c, "key")
+	if !ok {
+		return
+	}
+
+	var info *utils.CacheKeyInfo
+	var err error
+	switch tier := c.DefaultQuery("tier", utils.CacheTierLocal); tier {
+	case utils.CacheTierLocal:
+		info, err = utils.LocalCacheKey(key)
+	case utils.CacheTierRedis:
+		info, err = utils.RedisCacheKey(c.Request.Context(), key)
+	default:
+		abortUnknownTier(c, tier)
+		return
+	}
+	if err != nil {
+		renderCacheError(c, err)
+		return
+	}
+	renderData(c, info)
+}
+
+// DeleteCacheKey 删除缓存键
+func DeleteCacheKey(c *gin.Context) {
+	key, ok := requiredQuery(c, "key")
+	if !ok {
+		return
+	}
+
+	var err error
+	switch tier := c.DefaultQuery("tier", utils.CacheTierLocal); tier {
+	case utils.CacheTierLocal:
+		err = utils.DeleteLocalCacheKey(key)
+	case utils.CacheTierRedis:
+		err = utils.DeleteRedisCacheKey(c.Request.Context(), key)
+	default:
+		abortUnknownTier(c, tier)
+		return
+	}
+	if err != nil {
+		renderCacheError(c, err)
+		return
+	}
+	renderOK(c)
+}
+
+// DeleteCachePrefix 删除指定前缀的缓存键
+func DeleteCachePrefix(c *gin.Context) {
+	prefix, ok := requiredQuery(c, "prefix")
+	if !ok {
+		return
+	}
+
+	var deleted int64
+	switch tier := c.DefaultQuery("tier", utils.CacheTierLocal); tier {
+	case utils.CacheTierLocal:
+		n, err := utils.DeleteLocalCachePrefix(prefix)
+		if err != nil {
+			renderCacheError(c, err)
+			return
+		}
+		deleted = int64(n)
+	case utils.CacheTierRedis:
+		n, err := utils.DeleteRedisCachePrefix(c.Request.Context(), prefix)
+		if err != nil {
+			renderCacheError(c, err)
+			return
+		}
+		deleted = n
+	default:
+		abortUnknownTier(c, tier)
+		return
+	}
+	renderData(c, gin.H{"deleted": deleted})
+}
+
+// WarmCacheKey 将redis中的缓存数据预热到本地缓存
+func WarmCacheKey(c *gin.Context) {
+	key, ok := requiredQuery(c, "key")
+	if !ok {
+		return
+	}
+	info, err := utils.WarmLocalCache(c.Request.Context(), key)
+	if err != nil {
+		renderCacheError(c, err)
+		return
+	}
+	renderData(c, info)
+}
+
+// renderCacheError 根据缓存错误类型返回对应的状态码
+func renderCacheError(c *gin.Context, err error) {
+	switch err {
+	case utils.ErrCacheMiss:
+		abortWithAppError(c, apperr.New(CodeCacheKeyNotFound, ""))
+	case utils.ErrLocalCacheDisabled, utils.ErrRedisCacheDisabled, utils.ErrRedisClusterScan:
+		abortWithError(c, http.StatusBadRequest, err.Error())
+	default:
+		abortWithAppError(c, apperr.Wrap(apperr.CodeInternal, err, "cache operation error"))
+	}
+}
+
+func abortUnknownTier(c *gin.Context, tier string) {
+	abortWithError(c, http.StatusBadRequest,
+		fmt.Sprintf("unknown cache tier '%s', must in [%s|%s]", tier, utils.CacheTierLocal, utils.CacheTierRedis))
+}
+
+// requiredQuery 获取必填的查询参数，参数为空时返回 400
+func requiredQuery(c *gin.Context, name string) (string, bool) {
+	v := c.Query(name)
+	if v == "" {
+		abortWithError(c, http.StatusBadRequest, fmt.Sprintf("query parameter '%s' is required", name))
+		return "", false
+	}
+	return v, true
+}
+
+// queryInt 获取整数类型的查询参数，参数格式错误时返回 400
+func queryInt(c *gin.Context, name string, defaultValue int) (int, bool) {
+	v, ok := c.GetQuery(name)
+	if !ok || v == "" {
+		return defaultValue, true
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		abortWithError(c, http.StatusBadRequest, fmt.Sprintf("query parameter '%s' must be a non-negative integer", name))
+		return 0, false
+	}
+	return i, true
+}
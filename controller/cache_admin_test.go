@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestCacheAdmin(t *testing.T) {
+	router := gin.New()
+	router.GET("/testing/cache/keys", CacheKeys)
+	router.DELETE("/testing/cache/keys", DeleteCachePrefix)
+	router.GET("/testing/cache/key", CacheKey)
+	router.DELETE("/testing/cache/key", DeleteCacheKey)
+
+	request := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	ctx := context.TODO()
+	for _, key := range []string{"testing:admin:1", "testing:admin:2", "testing:admin:3"} {
+		assert.Equal(t, nil, utils.CacheSet(ctx, key, "value", time.Minute))
+	}
+
+	w := request("GET", "/testing/cache/keys?prefix=testing:admin:&offset=1&limit=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Data struct {
+			Keys  []*utils.CacheKeyInfo `json:"keys"`
+			Total int                   `json:"total"`
+		} `json:"data"`
+	}
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 3, page.Data.Total)
+	assert.Equal(t, 1, len(page.Data.Keys))
+	assert.Equal(t, "testing:admin:2", page.Data.Keys[0].Key)
+
+	w = request("GET", "/testing/cache/key?key=testing:admin:1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request("DELETE", "/testing/cache/key?key=testing:admin:1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request("GET", "/testing/cache/key?key=testing:admin:1")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = request("DELETE", "/testing/cache/keys?prefix=testing:admin:")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"code":200,"msg":"ok","data":{"deleted":2}}`, w.Body.String())
+
+	w = request("GET", "/testing/cache/keys?tier=unknown")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("GET", "/testing/cache/keys?tier=redis")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
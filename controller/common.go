@@ -1,12 +1,14 @@
 package controller
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/frank-yf/go-web-example/utils"
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/frank-yf/go-web-example/utils/json"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 )
 
 // Ping 健康监测接口
@@ -14,49 +16,173 @@ func Ping(c *gin.Context) {
 	renderOK(c)
 }
 
-// RedisPoolStats redis连接池统计数据
+// RedisPoolStats redis连接池统计数据与熔断器状态，通过参数 name 指定redis客户端，默认为 default
 func RedisPoolStats(c *gin.Context) {
-	ctx := context.TODO()
-	if ping, ok := utils.PingRedis(ctx); !ok {
-		renderError(c, fmt.Sprintf("ping redis failed: %s", ping))
+	name := c.DefaultQuery("name", utils.RedisNameDefault)
+	if !utils.HasRedisCliNamed(name) {
+		abortWithAppError(c, apperr.Newf(CodeRedisClientNotFound, "unknown redis client '%s'", name))
+		return
+	}
+	breaker := utils.GetRedisBreakerStats(name)
+	if ping, ok := utils.PingRedisNamed(c.Request.Context(), name); !ok {
+		abortWithAppError(c, apperr.Newf(CodeRedisUnavailable, "ping redis '%s' failed: %s", name, ping).
+			WithDetails(gin.H{"breaker": breaker}))
+		return
+	}
+	stats := struct {
+		*redis.PoolStats
+		Breaker *utils.BreakerStats `json:"breaker"`
+	}{
+		PoolStats: utils.GetRedisCliNamed(name).PoolStats(),
+		Breaker:   breaker,
+	}
+	renderData(c, stats)
+}
+
+// RedisCommandStats redis命令耗时与错误统计，通过参数 name 指定redis客户端，默认为 default
+func RedisCommandStats(c *gin.Context) {
+	name := c.DefaultQuery("name", utils.RedisNameDefault)
+	stats := utils.GetRedisCommandStats(name)
+	if stats == nil {
+		abortWithAppError(c, apperr.Newf(CodeRedisClientNotFound, "unknown redis client '%s'", name))
 		return
 	}
-	stats := utils.GetRedisCli().PoolStats()
 	renderData(c, stats)
 }
 
+// RedisHealth 检查所有redis客户端的连接
+func RedisHealth(c *gin.Context) {
+	health, ok := utils.RedisHealth(c.Request.Context())
+	if !ok {
+		abortWithAppError(c, apperr.New(CodeRedisUnavailable, "").WithDetails(health))
+		return
+	}
+	renderData(c, health)
+}
+
 // LocalCacheStats cache统计数据
 func LocalCacheStats(c *gin.Context) {
-	stats := utils.GetCacheCli().Stats()
+	stats := utils.GetCacheStats()
 	renderData(c, stats)
 }
 
-// RedisSubscribes redis订阅列表
+// RedisSubscribes redis订阅列表及其运行状态，通道与通配符模式分开展示
 func RedisSubscribes(c *gin.Context) {
-	channels := utils.GetRedisSubPool().Lookup()
-	renderData(c, channels)
+	pool := utils.GetRedisSubPool()
+	renderData(c, gin.H{
+		"channels": pool.Lookup(),
+		"patterns": pool.LookupPatterns(),
+	})
 }
 
-// CancelRedisSubscribe 取消指定通道的redis订阅
-func CancelRedisSubscribe(c *gin.Context) {
-	channel := c.Query("channel")
-	loaded, err := utils.GetRedisSubPool().Unsubscribe(c, channel)
-	if err != nil {
-		renderError(c, fmt.Sprintf("cancel subscribe '%s' error : %s", channel, err.Error()))
+// RedisSubscribeHandlers 可以通过 SubscribeRedis 订阅的处理函数名称
+func RedisSubscribeHandlers(c *gin.Context) {
+	renderData(c, utils.SubscribeHandlers())
+}
+
+// subscribeRedisRequest 订阅redis通道的请求参数，channel 与 pattern 只能指定一个
+type subscribeRedisRequest struct {
+	Channel  string                 `json:"channel"`
+	Pattern  string                 `json:"pattern"`
+	Handler  string                 `json:"handler" binding:"required"`
+	Consumer *utils.ConsumerOptions `json:"consumer"`
+}
+
+// SubscribeRedis 使用已注册的处理函数订阅通道或通配符模式
+// 处理函数未注册或处理配置超过上限时返回 400，已经订阅时返回 409，失败的订阅会被重新订阅替换
+func SubscribeRedis(c *gin.Context) {
+	var req subscribeRedisRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithAppError(c, bindError("invalid subscribe request", err))
 		return
 	}
+	if (req.Channel == "") == (req.Pattern == "") {
+		abortWithError(c, http.StatusBadRequest, "one of channel and pattern is required")
+		return
+	}
+	name, pattern := req.Channel, req.Pattern != ""
+	if pattern {
+		name = req.Pattern
+	}
+	info, err := utils.GetRedisSubPool().SubscribeNamed(req.Handler, name, pattern, req.Consumer)
+	switch {
+	case err == utils.ErrSubscriptionExists:
+		abortWithAppError(c, apperr.New(CodeSubscriptionExists, fmt.Sprint("subscription exists : ", name)))
+	case err == utils.ErrSubscribeHandlerNotFound:
+		abortWithAppError(c, apperr.New(CodeSubscribeHandlerNotFound, fmt.Sprint("subscribe handler not found : ", req.Handler)))
+	case err != nil:
+		abortWithError(c, http.StatusBadRequest, fmt.Sprintf("subscribe '%s' error : %s", name, err.Error()))
+	default:
+		c.JSON(http.StatusCreated, ResponseOK(info))
+	}
+}
+
+// UnsubscribeRedis 取消指定通道或通配符模式的redis订阅，订阅不存在时返回 404
+// 参数 pattern 不为空时取消通配符模式的订阅，否则取消参数 channel 指定通道的订阅
+func UnsubscribeRedis(c *gin.Context) {
+	pool := utils.GetRedisSubPool()
+	name, unsubscribe := c.Query("channel"), pool.Unsubscribe
+	if pattern := c.Query("pattern"); pattern != "" {
+		name, unsubscribe = pattern, pool.PUnsubscribe
+	}
+	if name == "" {
+		abortWithError(c, http.StatusBadRequest, "one of channel and pattern is required")
+		return
+	}
+	loaded, err := unsubscribe(c.Request.Context(), name)
 	if !loaded {
-		renderError(c, fmt.Sprint("channel exist : ", channel))
+		abortWithAppError(c, apperr.New(CodeSubscriptionNotFound, fmt.Sprint("subscription not found : ", name)))
+		return
+	}
+	if err != nil {
+		abortWithAppError(c, apperr.Wrap(apperr.CodeInternal, err, fmt.Sprintf("cancel subscribe '%s' error", name)))
 		return
 	}
 	renderOK(c)
 }
 
+// publishRedisMessageRequest 发布redis消息的请求参数
+type publishRedisMessageRequest struct {
+	Channel string          `json:"channel" binding:"required"`
+	Type    string          `json:"type" binding:"required"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// PublishRedisMessage 以统一格式向指定通道发布redis消息，用于运维测试订阅
+func PublishRedisMessage(c *gin.Context) {
+	var req publishRedisMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithAppError(c, bindError("invalid publish request", err))
+		return
+	}
+	env, receivers, err := utils.Publish(c.Request.Context(), req.Channel, req.Type, req.Payload)
+	if err != nil {
+		abortWithAppError(c, apperr.Wrap(apperr.CodeInternal, err, fmt.Sprintf("publish to '%s' error", req.Channel)))
+		return
+	}
+	renderData(c, gin.H{
+		"envelope":  env,
+		"receivers": receivers,
+	})
+}
+
+// HeldLocks 当前进程持有的分布式锁
+func HeldLocks(c *gin.Context) {
+	renderData(c, utils.HeldLocks())
+}
+
+// LeaderElections 当前进程参与的 leader 选举及当前的 leader 实例
+func LeaderElections(c *gin.Context) {
+	renderData(c, utils.LeaderElections(c.Request.Context()))
+}
+
+// Goroutines 受管理的 goroutine 的运行状态
+func Goroutines(c *gin.Context) {
+	renderData(c, utils.Goroutines())
+}
+
 // Recovery 统一处理接口调用过程中的panic，避免影响web服务
 func Recovery(c *gin.Context, recovered interface{}) {
-	if err, ok := recovered.(string); ok {
-		renderServerError(c, err)
-	} else {
-		c.AbortWithStatus(http.StatusInternalServerError)
-	}
+	msg, _ := recovered.(string)
+	abortWithAppError(c, apperr.New(apperr.CodeInternal, msg))
 }
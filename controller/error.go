@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// 管理接口的业务错误码
+var (
+	CodeSubscribeHandlerNotFound = apperr.Define(40001, "subscribe_handler_not_found", http.StatusBadRequest, "subscribe handler not found")
+	CodeRedisClientNotFound      = apperr.Define(40401, "redis_client_not_found", http.StatusNotFound, "unknown redis client")
+	CodeCacheKeyNotFound         = apperr.Define(40402, "cache_key_not_found", http.StatusNotFound, "cache key not found")
+	CodeStreamNotFound           = apperr.Define(40403, "stream_not_found", http.StatusNotFound, "stream or group not found")
+	CodeJobNotFound              = apperr.Define(40404, "job_not_found", http.StatusNotFound, "job not found")
+	CodeQueueJobNotFound         = apperr.Define(40405, "queue_job_not_found", http.StatusNotFound, "dead job not found")
+	CodeSubscriptionNotFound     = apperr.Define(40406, "subscription_not_found", http.StatusNotFound, "subscription not found")
+	CodeSubscriptionExists       = apperr.Define(40901, "subscription_exists", http.StatusConflict, "subscription exists")
+	CodeRedisUnavailable         = apperr.Define(50301, "redis_unavailable", http.StatusServiceUnavailable, "redis unavailable")
+)
+
+// ErrorHandler 将处理过程中通过 c.Error 记录且尚未响应的错误转换为统一的错误响应
+// 记录了多个错误时以最后一个为准
+func ErrorHandler(c *gin.Context) {
+	c.Next()
+	if c.Writer.Written() || len(c.Errors) == 0 {
+		return
+	}
+	renderAppError(c, apperr.From(c.Errors.Last().Err))
+}
+
+// ErrorCatalog 所有错误码及其对应的 HTTP 状态码与默认错误信息
+func ErrorCatalog(c *gin.Context) {
+	renderData(c, apperr.Catalog())
+}
+
+// bindError 请求参数绑定失败的错误，参数校验失败时记录失败的字段
+func bindError(msg string, err error) *apperr.Error {
+	e := apperr.New(apperr.CodeInvalidArgument, fmt.Sprint(msg, " : ", err.Error()))
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return e
+	}
+	fields := make([]apperr.FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, apperr.FieldError{
+			Field:  fe.Field(),
+			Reason: fmt.Sprintf("failed on the '%s' rule", fe.Tag()),
+		})
+	}
+	return e.WithFields(fields...)
+}
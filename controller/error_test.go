@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestErrorHandler(t *testing.T) {
+	router := gin.New()
+	router.Use(gin.CustomRecovery(Recovery), ErrorHandler)
+	router.GET("/testing/not_found", func(c *gin.Context) {
+		_ = c.Error(apperr.New(CodeJobNotFound, "job not found : testing"))
+	})
+	router.GET("/testing/internal", func(c *gin.Context) {
+		_ = c.Error(errors.New("testing error"))
+	})
+	router.GET("/testing/written", func(c *gin.Context) {
+		_ = c.Error(errors.New("testing error"))
+		renderOK(c)
+	})
+	router.GET("/testing/panic", func(c *gin.Context) {
+		panic("testing panic")
+	})
+
+	request := func(target string) (*httptest.ResponseRecorder, ResponseEntity) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", target, nil)
+		router.ServeHTTP(w, req)
+		var resp ResponseEntity
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, resp := request("/testing/not_found")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, int(CodeJobNotFound), resp.Code)
+	assert.Equal(t, "job not found : testing", resp.Msg)
+
+	w, resp = request("/testing/internal")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, int(apperr.CodeInternal), resp.Code)
+	assert.Equal(t, "internal server error", resp.Msg)
+
+	w, resp = request("/testing/written")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	w, resp = request("/testing/panic")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "testing panic", resp.Msg)
+}
+
+func TestErrorCatalog(t *testing.T) {
+	router := gin.New()
+	router.GET("/testing/errors", ErrorCatalog)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/testing/errors", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data []*apperr.Definition `json:"data"`
+	}
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &resp))
+	found := false
+	for _, def := range resp.Data {
+		if def.Code == CodeSubscriptionExists {
+			found = true
+			assert.Equal(t, http.StatusConflict, def.Status)
+			assert.Equal(t, "subscription_exists", def.Name)
+		}
+	}
+	assert.Equal(t, true, found)
+}
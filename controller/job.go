@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduledJobs 查看所有定时任务的运行状态
+func ScheduledJobs(c *gin.Context) {
+	renderData(c, utils.ScheduledJobs(c.Request.Context()))
+}
+
+// JobHistory 查看定时任务在当前实例上的执行记录
+// 参数：name 任务名称
+func JobHistory(c *gin.Context) {
+	job, ok := requiredJob(c)
+	if !ok {
+		return
+	}
+	renderData(c, job.History())
+}
+
+// TriggerJob 立即执行一次定时任务，分布式任务仍然需要获取任务锁
+// 参数：name 任务名称
+func TriggerJob(c *gin.Context) {
+	job, ok := requiredJob(c)
+	if !ok {
+		return
+	}
+	job.Trigger()
+	renderOK(c)
+}
+
+// PauseJob 暂停定时任务的按计划执行
+// 参数：name 任务名称
+func PauseJob(c *gin.Context) {
+	job, ok := requiredJob(c)
+	if !ok {
+		return
+	}
+	if err := job.Pause(c.Request.Context()); err != nil {
+		abortWithAppError(c, apperr.Wrap(apperr.CodeInternal, err, fmt.Sprintf("pause job '%s' error", c.Query("name"))))
+		return
+	}
+	renderOK(c)
+}
+
+// ResumeJob 恢复定时任务的按计划执行
+// 参数：name 任务名称
+func ResumeJob(c *gin.Context) {
+	job, ok := requiredJob(c)
+	if !ok {
+		return
+	}
+	if err := job.Resume(c.Request.Context()); err != nil {
+		abortWithAppError(c, apperr.Wrap(apperr.CodeInternal, err, fmt.Sprintf("resume job '%s' error", c.Query("name"))))
+		return
+	}
+	renderOK(c)
+}
+
+// requiredJob 根据参数 name 获取定时任务，任务不存在时返回 404
+func requiredJob(c *gin.Context) (*utils.ScheduledJob, bool) {
+	name, ok := requiredQuery(c, "name")
+	if !ok {
+		return nil, false
+	}
+	job, err := utils.GetScheduledJob(name)
+	if err != nil {
+		abortWithAppError(c, apperr.New(CodeJobNotFound, fmt.Sprint("job not found : ", name)))
+		return nil, false
+	}
+	return job, true
+}
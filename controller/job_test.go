@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestJobAdmin(t *testing.T) {
+	router := gin.New()
+	router.GET("/testing/jobs/history", JobHistory)
+	router.POST("/testing/jobs/trigger", TriggerJob)
+
+	request := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	job, err := utils.ScheduleJob(&utils.JobOptions{Name: "testing:admin", Cron: "@yearly", Local: true},
+		func(context.Context) error { return nil })
+	assert.Equal(t, nil, err)
+	defer job.Stop(context.TODO())
+
+	w := request("POST", "/testing/jobs/trigger")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("POST", "/testing/jobs/trigger?name=unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = request("POST", "/testing/jobs/trigger?name=testing:admin")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for i := 0; i < 100 && len(job.History()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	w = request("GET", "/testing/jobs/history?name=testing:admin")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, len(job.History()))
+}
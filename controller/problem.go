@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// MIMEProblemJSON RFC 7807 定义的错误响应格式
+	MIMEProblemJSON = "application/problem+json"
+
+	// ErrorFormatEntity 错误响应使用 ResponseEntity 格式
+	ErrorFormatEntity = "entity"
+	// ErrorFormatProblem 错误响应使用 RFC 7807 格式
+	ErrorFormatProblem = "problem"
+
+	// problemTypePrefix 错误类型的 URI 前缀，后接错误码名称
+	problemTypePrefix = "urn:problem-type:"
+)
+
+// errorFormat 请求未指定 Accept: application/problem+json 时错误响应的格式
+var errorFormat = ErrorFormatEntity
+
+// SetErrorFormat 设置错误响应的默认格式，为空时使用 ErrorFormatEntity
+func SetErrorFormat(format string) error {
+	switch format {
+	case "":
+		errorFormat = ErrorFormatEntity
+	case ErrorFormatEntity, ErrorFormatProblem:
+		errorFormat = format
+	default:
+		return fmt.Errorf("unknown error format '%s', must in [%s|%s]", format, ErrorFormatEntity, ErrorFormatProblem)
+	}
+	return nil
+}
+
+// Problem RFC 7807 格式的错误响应，code、request_id、errors、details 为扩展字段
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	Code      int                 `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []apperr.FieldError `json:"errors,omitempty"`
+	Details   interface{}         `json:"details,omitempty"`
+}
+
+// newProblem 将应用错误转换为 RFC 7807 格式，title 为错误码的默认信息，detail 为本次的错误信息
+func newProblem(c *gin.Context, e *apperr.Error) *Problem {
+	def := apperr.Lookup(e.Code)
+	return &Problem{
+		Type:      problemTypePrefix + def.Name,
+		Title:     def.Message,
+		Status:    def.Status,
+		Detail:    e.Message,
+		Instance:  c.Request.URL.Path,
+		Code:      int(e.Code),
+		RequestID: c.GetString(RequestIDKey),
+		Errors:    e.Fields,
+		Details:   e.Details,
+	}
+}
+
+// wantsProblem 请求头 Accept 包含 application/problem+json 或默认格式为 problem 时返回 RFC 7807 格式
+func wantsProblem(c *gin.Context) bool {
+	return errorFormat == ErrorFormatProblem || strings.Contains(c.GetHeader("Accept"), MIMEProblemJSON)
+}
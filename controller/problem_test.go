@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestProblemResponse(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestID)
+	router.GET("/testing/jobs", func(c *gin.Context) {
+		requiredJob(c)
+	})
+	router.POST("/testing/publish", PublishRedisMessage)
+
+	request := func(method, target, accept, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Accept", accept)
+		req.Header.Set(HeaderRequestID, "testing-request")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("GET", "/testing/jobs?name=unknown", "application/json", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"code":40404,"msg":"job not found : unknown"}`, w.Body.String())
+
+	w = request("GET", "/testing/jobs?name=unknown", MIMEProblemJSON+", application/json", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, MIMEProblemJSON, w.Header().Get("Content-Type"))
+	var problem Problem
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "urn:problem-type:job_not_found", problem.Type)
+	assert.Equal(t, "job not found", problem.Title)
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Equal(t, "job not found : unknown", problem.Detail)
+	assert.Equal(t, "/testing/jobs", problem.Instance)
+	assert.Equal(t, int(CodeJobNotFound), problem.Code)
+	assert.Equal(t, "testing-request", problem.RequestID)
+
+	w = request("POST", "/testing/publish", MIMEProblemJSON, `{"channel":"testing"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	problem = Problem{}
+	assert.Equal(t, nil, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, int(apperr.CodeInvalidArgument), problem.Code)
+	assert.Equal(t, []apperr.FieldError{{Field: "Type", Reason: "failed on the 'required' rule"}}, problem.Errors)
+}
+
+func TestSetErrorFormat(t *testing.T) {
+	defer SetErrorFormat("")
+	assert.NotEqual(t, nil, SetErrorFormat("xml"))
+	assert.Equal(t, nil, SetErrorFormat(ErrorFormatProblem))
+
+	router := gin.New()
+	router.GET("/testing/jobs", func(c *gin.Context) {
+		requiredJob(c)
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/testing/jobs", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, MIMEProblemJSON, w.Header().Get("Content-Type"))
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultDeadJobsLimit 默认返回的失败任务数量
+	defaultDeadJobsLimit = 20
+	maxDeadJobsLimit     = 1000
+)
+
+// QueueWorkers 查看当前进程中所有队列消费者的统计数据
+func QueueWorkers(c *gin.Context) {
+	renderData(c, utils.QueueWorkers())
+}
+
+// QueueDepth 查看队列中待处理、延迟、处理中与失败的任务数
+// 参数：queue 队列名称
+func QueueDepth(c *gin.Context) {
+	queue, ok := requiredQuery(c, "queue")
+	if !ok {
+		return
+	}
+	depth, err := utils.GetQueueDepth(c.Request.Context(), queue)
+	if err != nil {
+		abortWithAppError(c, apperr.Wrap(apperr.CodeInternal, err, "get queue depth error"))
+		return
+	}
+	renderData(c, depth)
+}
+
+// DeadQueueJobs 分页查看失败任务，按失败时间倒序
+// 参数：queue 队列名称；offset 偏移量；limit 返回数量，默认20，最大1000
+func DeadQueueJobs(c *gin.Context) {
+	queue, ok := requiredQuery(c, "queue")
+	if !ok {
+		return
+	}
+	offset, ok := queryInt(c, "offset", 0)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultDeadJobsLimit)
+	if !ok {
+		return
+	}
+	if limit > maxDeadJobsLimit {
+		abortWithError(c, http.StatusBadRequest, fmt.Sprintf("limit must in [0, %d]", maxDeadJobsLimit))
+		return
+	}
+	jobs, total, err := utils.DeadQueueJobs(c.Request.Context(), queue, int64(offset), int64(limit))
+	if err != nil {
+		abortWithAppError(c, apperr.Wrap(apperr.CodeInternal, err, "list dead jobs error"))
+		return
+	}
+	renderData(c, gin.H{
+		"jobs":  jobs,
+		"total": total,
+	})
+}
+
+// RequeueDeadJob 将失败任务重置处理次数后重新放入队列
+// 参数：queue 队列名称；id 任务ID
+func RequeueDeadJob(c *gin.Context) {
+	queue, ok := requiredQuery(c, "queue")
+	if !ok {
+		return
+	}
+	id, ok := requiredQuery(c, "id")
+	if !ok {
+		return
+	}
+	job, err := utils.RequeueDeadJob(c.Request.Context(), queue, id)
+	if err == utils.ErrQueueJobNotFound {
+		abortWithAppError(c, apperr.New(CodeQueueJobNotFound, fmt.Sprint("dead job not found : ", id)))
+		return
+	}
+	if err != nil {
+		abortWithAppError(c, apperr.Wrap(apperr.CodeInternal, err, fmt.Sprintf("requeue job '%s' error", id)))
+		return
+	}
+	renderData(c, job)
+}
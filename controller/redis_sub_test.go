@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestRedisSubscribeAdmin(t *testing.T) {
+	router := gin.New()
+	router.POST("/testing/redis_sub/", SubscribeRedis)
+	router.DELETE("/testing/redis_sub/", UnsubscribeRedis)
+	router.POST("/testing/redis_sub/publish", PublishRedisMessage)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/testing/redis_sub/", `{"channel":"testing:admin"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("POST", "/testing/redis_sub/", `{"channel":"testing:admin","pattern":"testing:*","handler":"log"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("POST", "/testing/redis_sub/", `{"channel":"testing:admin","handler":"unknown"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("POST", "/testing/redis_sub/", `{"channel":"testing:admin","handler":"`+utils.SubscribeHandlerLog+`"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = request("POST", "/testing/redis_sub/", `{"channel":"testing:admin","handler":"`+utils.SubscribeHandlerCacheDelete+`"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = request("DELETE", "/testing/redis_sub/?channel=testing:admin", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request("DELETE", "/testing/redis_sub/?channel=testing:admin", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = request("DELETE", "/testing/redis_sub/", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("POST", "/testing/redis_sub/publish", `{"type":"testing"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
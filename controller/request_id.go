@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HeaderRequestID 请求ID的请求头与响应头
+	HeaderRequestID = "X-Request-ID"
+	// RequestIDKey 请求ID在 gin.Context 中的键
+	RequestIDKey = "requestId"
+
+	maxRequestIDLength = 64
+)
+
+// RequestID 为每个请求分配请求ID，并保存到请求的 context 中
+// 客户端传入的请求ID合法时沿用，否则重新生成
+func RequestID(c *gin.Context) {
+	id := c.GetHeader(HeaderRequestID)
+	if !validRequestID(id) {
+		id = utils.NewRequestID()
+	}
+	c.Set(RequestIDKey, id)
+	c.Header(HeaderRequestID, id)
+	c.Request = c.Request.WithContext(utils.WithRequestID(c.Request.Context(), id))
+	c.Next()
+}
+
+// validRequestID 请求ID只允许使用字母、数字以及 - _ .
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestRequestID(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestID)
+	router.GET("/testing/request_id", func(c *gin.Context) {
+		c.String(http.StatusOK, utils.RequestIDFromContext(c.Request.Context()))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/testing/request_id", nil)
+	req.Header.Set(HeaderRequestID, "abc-123")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "abc-123", w.Body.String())
+	assert.Equal(t, "abc-123", w.Header().Get(HeaderRequestID))
+
+	// 不合法的请求ID会被重新生成
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/testing/request_id", nil)
+	req.Header.Set(HeaderRequestID, "bad id\n")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 32, len(w.Body.String()))
+	assert.Equal(t, w.Body.String(), w.Header().Get(HeaderRequestID))
+}
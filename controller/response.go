@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/frank-yf/go-web-example/utils"
+	"github.com/frank-yf/go-web-example/utils/apperr"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -19,10 +20,14 @@ var (
 	}
 )
 
+// ResponseEntity 统一的响应格式，成功时 Code 为 200，失败时为 apperr 定义的错误码
 type ResponseEntity struct {
 	Code int         `json:"code"`
 	Msg  string      `json:"msg"`
 	Data interface{} `json:"data,omitempty"`
+	// Details、Errors 错误详情与参数校验失败的字段，只在错误响应中返回
+	Details interface{}         `json:"details,omitempty"`
+	Errors  []apperr.FieldError `json:"errors,omitempty"`
 }
 
 func ResponseOK(data interface{}) *ResponseEntity {
@@ -33,13 +38,6 @@ func ResponseOK(data interface{}) *ResponseEntity {
 	}
 }
 
-func ResponseError(errMsg string) *ResponseEntity {
-	return &ResponseEntity{
-		Code: http.StatusInternalServerError,
-		Msg:  errMsg,
-	}
-}
-
 func renderOK(c *gin.Context) {
 	c.JSON(http.StatusOK, OK)
 }
@@ -48,11 +46,37 @@ func renderData(c *gin.Context, data interface{}) {
 	c.JSON(http.StatusOK, ResponseOK(data))
 }
 
-func renderError(c *gin.Context, errMsg string) {
-	c.JSON(http.StatusOK, ResponseError(errMsg))
+// abortWithError 中止后续处理，并以对应的 HTTP 状态码返回通用错误码与错误信息
+func abortWithError(c *gin.Context, status int, errMsg string) {
+	renderAppError(c, apperr.FromStatus(status, errMsg))
 }
 
-func renderServerError(c *gin.Context, errMsg string) {
-	c.JSON(http.StatusInternalServerError, ResponseError(errMsg))
-	utils.GetLogger().Warn("response error message", zap.String("msg", errMsg))
+// abortWithAppError 中止后续处理，并按应用错误的错误码返回，非应用错误按内部错误处理
+func abortWithAppError(c *gin.Context, err error) {
+	renderAppError(c, apperr.From(err))
+}
+
+// renderAppError 以错误码对应的 HTTP 状态码返回错误，服务端错误记录到日志
+// 按 wantsProblem 选择 RFC 7807 格式或 ResponseEntity 格式
+func renderAppError(c *gin.Context, e *apperr.Error) {
+	status := e.Status()
+	if status >= http.StatusInternalServerError {
+		utils.GetLogger().Warn("response error",
+			zap.Int("code", int(e.Code)),
+			zap.String("msg", e.Message),
+			zap.String("requestId", c.GetString(RequestIDKey)),
+			zap.Error(e.Cause),
+		)
+	}
+	if wantsProblem(c) {
+		c.Header("Content-Type", MIMEProblemJSON)
+		c.AbortWithStatusJSON(status, newProblem(c, e))
+		return
+	}
+	c.AbortWithStatusJSON(status, ResponseEntity{
+		Code:    int(e.Code),
+		Msg:     e.Message,
+		Details: e.Details,
+		Errors:  e.Fields,
+	})
 }
@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/cache/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// responseCacheKeyPrefix 接口响应缓存键的前缀
+	responseCacheKeyPrefix = "resp:"
+	// defaultResponseCacheTTL 接口响应默认的缓存时长
+	defaultResponseCacheTTL = time.Minute
+
+	headerCacheStatus = "X-Cache"
+)
+
+// ResponseCacheOptions 接口响应缓存配置
+type ResponseCacheOptions struct {
+	// TTL 响应的缓存时长，默认1分钟
+	TTL time.Duration
+	// QueryParams 参与缓存键计算的查询参数，未列出的参数不影响缓存命中
+	QueryParams []string
+	// Headers 参与缓存键计算的请求头
+	Headers []string
+	// Redis 是否同时写入 GetCacheCli 的 redis 缓存，否则只缓存在本地内存（redis 缓存模式除外）
+	Redis bool
+	// InvalidateChannel 订阅该通道删除本地缓存，消息内容为 ResponseCacheKey 计算出的缓存键
+	InvalidateChannel string
+}
+
+func (o *ResponseCacheOptions) ttl() time.Duration {
+	if o.TTL > 0 {
+		return o.TTL
+	}
+	return defaultResponseCacheTTL
+}
+
+func (o *ResponseCacheOptions) cacheCli() *cache.Cache {
+	if !o.Redis {
+		if cli := utils.GetLocalCacheCli(); cli != nil {
+			return cli
+		}
+	}
+	// 没有本地缓存时，只能使用redis缓存；redis熔断器打开时降级为本地缓存
+	return utils.GetAvailableCacheCli()
+}
+
+// cachedResponse 缓存的响应内容
+type cachedResponse struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	ETag     string
+	ExpireAt time.Time
+}
+
+// ResponseCache 缓存 GET 请求的成功响应
+// 支持请求头 Cache-Control 的 no-cache、no-store 指令，以及基于 ETag 的 304 响应
+func ResponseCache(opts *ResponseCacheOptions) gin.HandlerFunc {
+	if opts.InvalidateChannel != "" {
+		utils.RegisteDeleteCache(opts.InvalidateChannel)
+	}
+	maxAge := "max-age=" + strconv.FormatInt(int64(opts.ttl()/time.Second), 10)
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		directives := c.GetHeader("Cache-Control")
+		if strings.Contains(directives, "no-store") {
+			c.Next()
+			return
+		}
+
+		key := ResponseCacheKey(c.Request, opts)
+		cli := opts.cacheCli()
+		ctx := c.Request.Context()
+
+		if !strings.Contains(directives, "no-cache") {
+			var resp cachedResponse
+			if err := cli.Get(ctx, key, &resp); err == nil && time.Now().Before(resp.ExpireAt) {
+				writeCachedResponse(c, &resp, "HIT", maxAge)
+				c.Abort()
+				return
+			} else if err != nil && err != cache.ErrCacheMiss {
+				utils.GetLogger().Warn("get response cache error", zap.String("key", key), zap.Error(err))
+			}
+		}
+
+		writer := &bufferedResponseWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		resp := &cachedResponse{
+			Status:   writer.status,
+			Header:   cacheableHeader(writer.Header()),
+			Body:     writer.body.Bytes(),
+			ETag:     etag(writer.body.Bytes()),
+			ExpireAt: time.Now().Add(opts.ttl()),
+		}
+		if len(c.Errors) > 0 && len(resp.Body) == 0 {
+			// 通过 c.Error 记录的错误由 ErrorHandler 输出
+			return
+		}
+		if resp.Status != http.StatusOK || len(c.Errors) > 0 {
+			c.Writer.WriteHeader(resp.Status)
+			_, _ = c.Writer.Write(resp.Body)
+			return
+		}
+
+		err := cli.Set(&cache.Item{
+			Ctx:   ctx,
+			Key:   key,
+			Value: resp,
+			TTL:   opts.ttl(),
+		})
+		if err != nil {
+			utils.GetLogger().Warn("set response cache error", zap.String("key", key), zap.Error(err))
+		}
+		writeCachedResponse(c, resp, "MISS", maxAge)
+	}
+}
+
+// ResponseCacheKey 计算请求对应的缓存键
+// 缓存键由请求方法、路径以及配置中指定的查询参数和请求头组成
+func ResponseCacheKey(r *http.Request, opts *ResponseCacheOptions) string {
+	var b strings.Builder
+	b.WriteString(responseCacheKeyPrefix)
+	b.WriteString(r.Method)
+	b.WriteByte(':')
+	b.WriteString(r.URL.Path)
+
+	query := r.URL.Query()
+	selected := make(url.Values, len(opts.QueryParams))
+	for _, name := range opts.QueryParams {
+		if vs, ok := query[name]; ok {
+			selected[name] = vs
+		}
+	}
+	if len(selected) > 0 {
+		b.WriteByte('?')
+		b.WriteString(selected.Encode())
+	}
+
+	for _, name := range opts.Headers {
+		b.WriteByte('|')
+		b.WriteString(strings.ToLower(name))
+		b.WriteByte('=')
+		b.WriteString(r.Header.Get(name))
+	}
+	return b.String()
+}
+
+// writeCachedResponse 输出缓存的响应，客户端持有相同 ETag 时返回 304
+func writeCachedResponse(c *gin.Context, resp *cachedResponse, cacheStatus, maxAge string) {
+	h := c.Writer.Header()
+	for k, vs := range resp.Header {
+		h[k] = vs
+	}
+	h.Set("ETag", resp.ETag)
+	h.Set("Cache-Control", maxAge)
+	h.Set(headerCacheStatus, cacheStatus)
+
+	if matchETag(c.GetHeader("If-None-Match"), resp.ETag) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Status(resp.Status)
+	_, _ = c.Writer.Write(resp.Body)
+}
+
+// cacheableHeader 复制可以被缓存的响应头，不缓存与单次请求相关的响应头
+func cacheableHeader(header http.Header) http.Header {
+	h := header.Clone()
+	h.Del("Set-Cookie")
+	h.Del(headerCacheStatus)
+	h.Del(HeaderRequestID)
+	return h
+}
+
+// etag 根据响应内容生成弱校验的 ETag
+func etag(body []byte) string {
+	h := fnv.New64a()
+	_, _ = h.Write(body)
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// matchETag If-None-Match 请求头中是否包含指定的 ETag
+func matchETag(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponseWriter 暂存处理函数写入的响应，由缓存中间件统一输出
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *bufferedResponseWriter) Flush() {}
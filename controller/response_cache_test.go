@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestResponseCache(t *testing.T) {
+	calls := 0
+	router := gin.New()
+	router.Use(RequestID)
+	router.GET("/testing/response_cache", ResponseCache(&ResponseCacheOptions{
+		TTL:         time.Minute,
+		QueryParams: []string{"id"},
+	}), func(c *gin.Context) {
+		calls++
+		renderData(c, c.Query("id"))
+	})
+
+	request := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/testing/response_cache?id=1&ignored=a", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "max-age=60", w.Header().Get("Cache-Control"))
+	body, tag, requestID := w.Body.String(), w.Header().Get("ETag"), w.Header().Get(HeaderRequestID)
+
+	// 未参与缓存键计算的查询参数不影响命中
+	w = request("/testing/response_cache?id=1&ignored=b", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, body, w.Body.String())
+	assert.Equal(t, 1, calls)
+	// 命中缓存时返回本次请求的请求ID
+	assert.NotEqual(t, "", w.Header().Get(HeaderRequestID))
+	assert.NotEqual(t, requestID, w.Header().Get(HeaderRequestID))
+
+	w = request("/testing/response_cache?id=1", tag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "", w.Body.String())
+
+	w = request("/testing/response_cache?id=2", "")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, 2, calls)
+}
+
+func TestResponseCacheError(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestID, ErrorHandler)
+	router.GET("/testing/response_cache/error", ResponseCache(&ResponseCacheOptions{TTL: time.Minute}), func(c *gin.Context) {
+		_ = c.Error(apperr.New(CodeJobNotFound, "job not found : unknown"))
+	})
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/testing/response_cache/error", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, `{"code":40404,"msg":"job not found : unknown"}`, w.Body.String())
+		assert.Equal(t, "", w.Header().Get("X-Cache"))
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	opts := &ResponseCacheOptions{QueryParams: []string{"b", "a"}, Headers: []string{"Accept-Language"}}
+	req, _ := http.NewRequest("GET", "/v1/items?b=2&a=1&c=3", nil)
+	req.Header.Set("Accept-Language", "zh-CN")
+	assert.Equal(t, "resp:GET:/v1/items?a=1&b=2|accept-language=zh-CN", ResponseCacheKey(req, opts))
+}
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/frank-yf/go-web-example/utils"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -11,7 +13,10 @@ type routerRegister func(*gin.Engine)
 // InitRouter 加载路由
 func InitRouter() *gin.Engine {
 	router := gin.Default()
-	router.Use(gin.CustomRecovery(Recovery)) // panic处理
+	router.Use(gin.CustomRecovery(Recovery))     // panic处理
+	router.Use(SecurityHeaders(securityOptions)) // 安全响应头
+	router.Use(RequestID)                        // 请求ID
+	router.Use(ErrorHandler)                     // 统一错误响应
 
 	router.GET("/ping", Ping) // 心跳监测
 
@@ -25,9 +30,9 @@ func InitRouter() *gin.Engine {
 
 // registeLogic 业务逻辑相关接口
 func registeLogic(r *gin.Engine) {
-	v1 := r.Group("/v1")
+	v1 := r.Group("/v1", LimitBodySize(defaultMaxBodySize), AllowContentTypes(gin.MIMEJSON))
 	{
-		v1.GET("/", func(c *gin.Context) {
+		v1.GET("/", ResponseCache(&ResponseCacheOptions{TTL: 10 * time.Second}), func(c *gin.Context) {
 			renderData(c, "v1 response")
 		})
 	}
@@ -35,15 +40,57 @@ func registeLogic(r *gin.Engine) {
 
 // registeHandle 服务管理相关接口
 func registeHandle(r *gin.Engine) {
-	handler := r.Group("/handler", Authorization)
+	handler := r.Group("/handler", Authorization, LimitBodySize(defaultMaxBodySize))
 	{
 		handler.GET("/redis_stats", RedisPoolStats)
+		handler.GET("/redis_health", RedisHealth)
+		handler.GET("/redis_commands", RedisCommandStats)
 		handler.GET("/cache_stats", LocalCacheStats)
+		handler.GET("/locks", HeldLocks)
+		handler.GET("/leaders", LeaderElections)
+		handler.GET("/goroutines", Goroutines)
+		handler.GET("/errors", ErrorCatalog)
+
+		cacheRouter := handler.Group("/cache")
+		{
+			cacheRouter.GET("/keys", CacheKeys)
+			cacheRouter.DELETE("/keys", DeleteCachePrefix)
+			cacheRouter.GET("/key", CacheKey)
+			cacheRouter.DELETE("/key", DeleteCacheKey)
+			cacheRouter.POST("/warm", WarmCacheKey)
+		}
+
+		streamRouter := handler.Group("/streams")
+		{
+			streamRouter.GET("/", StreamConsumers)
+			streamRouter.GET("/groups", StreamGroups)
+			streamRouter.GET("/pending", StreamPending)
+		}
+
+		jobRouter := handler.Group("/jobs")
+		{
+			jobRouter.GET("/", ScheduledJobs)
+			jobRouter.GET("/history", JobHistory)
+			jobRouter.POST("/trigger", TriggerJob)
+			jobRouter.POST("/pause", PauseJob)
+			jobRouter.POST("/resume", ResumeJob)
+		}
+
+		queueRouter := handler.Group("/queues")
+		{
+			queueRouter.GET("/", QueueWorkers)
+			queueRouter.GET("/depth", QueueDepth)
+			queueRouter.GET("/failed", DeadQueueJobs)
+			queueRouter.POST("/requeue", RequeueDeadJob)
+		}
 
 		redisSubRouter := handler.Group("/redis_sub")
 		{
 			redisSubRouter.GET("/", RedisSubscribes)
-			redisSubRouter.GET("/cancel", CancelRedisSubscribe)
+			redisSubRouter.POST("/", SubscribeRedis)
+			redisSubRouter.DELETE("/", UnsubscribeRedis)
+			redisSubRouter.GET("/handlers", RedisSubscribeHandlers)
+			redisSubRouter.POST("/publish", PublishRedisMessage)
 		}
 
 		pprofRouter := handler.Group("/pprof")
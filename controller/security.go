@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultMaxBodySize 请求体默认的最大长度
+	defaultMaxBodySize = 1 << 20
+)
+
+// securityOptions InitRouter 使用的安全响应头配置
+var securityOptions = utils.DefaultSecurityOptions()
+
+// SetSecurityOptions 设置安全响应头的配置，需要在 InitRouter 之前执行，为空时使用默认配置
+func SetSecurityOptions(opts *utils.SecurityOptions) {
+	if opts == nil {
+		opts = utils.DefaultSecurityOptions()
+	}
+	securityOptions = opts
+}
+
+// SecurityHeaders 为所有响应添加安全相关的响应头，opts 为空时使用默认配置
+func SecurityHeaders(opts *utils.SecurityOptions) gin.HandlerFunc {
+	if opts == nil {
+		opts = utils.DefaultSecurityOptions()
+	}
+	headers := make(map[string]string, 5)
+	headers["X-Content-Type-Options"] = "nosniff"
+	if opts.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(opts.HSTSMaxAge.Std()/time.Second), 10)
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		headers["Strict-Transport-Security"] = hsts
+	}
+	if opts.FrameOptions != "" {
+		headers["X-Frame-Options"] = opts.FrameOptions
+	}
+	if opts.ReferrerPolicy != "" {
+		headers["Referrer-Policy"] = opts.ReferrerPolicy
+	}
+	if opts.ContentSecurityPolicy != "" {
+		headers["Content-Security-Policy"] = opts.ContentSecurityPolicy
+	}
+
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		for k, v := range headers {
+			h.Set(k, v)
+		}
+		c.Next()
+	}
+}
+
+// LimitBodySize 限制请求体的最大长度
+// 声明的 Content-Length 超出限制时直接拒绝；未声明长度的请求在读取超限时返回错误
+func LimitBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			abortWithError(c, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("request body too large, limit %d bytes", limit))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// AllowContentTypes 限制携带请求体的请求只能使用指定的 Content-Type
+func AllowContentTypes(contentTypes ...string) gin.HandlerFunc {
+	allowed := utils.NewSetFromSlice(contentTypes)
+	accept := strings.Join(contentTypes, ", ")
+	return func(c *gin.Context) {
+		if hasBody(c.Request) && !allowed.Has(c.ContentType()) {
+			abortWithError(c, http.StatusUnsupportedMediaType,
+				fmt.Sprintf("unsupported content type '%s', accept [%s]", c.ContentType(), accept))
+			return
+		}
+		c.Next()
+	}
+}
+
+// hasBody 请求是否携带了请求体
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || len(r.TransferEncoding) > 0
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	router := gin.New()
+	router.Use(SecurityHeaders(&utils.SecurityOptions{
+		HSTSMaxAge:            utils.Duration(time.Hour),
+		HSTSIncludeSubdomains: true,
+		FrameOptions:          "DENY",
+		ContentSecurityPolicy: "default-src 'self'",
+	}))
+	router.GET("/testing/security", Ping)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/testing/security", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "max-age=3600; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "default-src 'self'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "", w.Header().Get("Referrer-Policy"))
+}
+
+func TestLimitBodySize(t *testing.T) {
+	router := gin.New()
+	router.Use(LimitBodySize(8))
+	router.POST("/testing/body", func(c *gin.Context) {
+		if _, err := ioutil.ReadAll(c.Request.Body); err != nil {
+			abortWithError(c, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		renderOK(c)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/testing/body", strings.NewReader("12345678"))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/testing/body", strings.NewReader("123456789"))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// 未声明长度的请求体在读取时超限
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/testing/body", strings.NewReader("123456789"))
+	req.ContentLength = -1
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestAllowContentTypes(t *testing.T) {
+	router := gin.New()
+	router.Use(AllowContentTypes(gin.MIMEJSON))
+	router.POST("/testing/content_type", Ping)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/testing/content_type", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/testing/content_type", strings.NewReader("a=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	// 没有请求体时不校验 Content-Type
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/testing/content_type", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/frank-yf/go-web-example/utils"
+	"github.com/frank-yf/go-web-example/utils/apperr"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultStreamPendingLimit 默认返回的待确认消息明细数量
+	defaultStreamPendingLimit = 20
+	maxStreamPendingLimit     = 1000
+)
+
+// StreamConsumers 查看当前进程中所有消息流消费者的统计数据
+func StreamConsumers(c *gin.Context) {
+	renderData(c, utils.StreamConsumers())
+}
+
+// StreamGroups 查看消息流的所有消费组，包括积压数与待确认消息数
+// 参数：stream 消息流名称
+func StreamGroups(c *gin.Context) {
+	stream, ok := requiredQuery(c, "stream")
+	if !ok {
+		return
+	}
+	groups, err := utils.StreamGroups(c.Request.Context(), stream)
+	if err != nil {
+		renderStreamError(c, err)
+		return
+	}
+	renderData(c, groups)
+}
+
+// StreamPending 查看消费组的待确认消息
+// 参数：stream 消息流名称；group 消费组名称；limit 返回的待确认消息明细数量，默认20，最大1000
+func StreamPending(c *gin.Context) {
+	stream, ok := requiredQuery(c, "stream")
+	if !ok {
+		return
+	}
+	group, ok := requiredQuery(c, "group")
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(c, "limit", defaultStreamPendingLimit)
+	if !ok {
+		return
+	}
+	if limit > maxStreamPendingLimit {
+		abortWithError(c, http.StatusBadRequest, fmt.Sprintf("limit must in [0, %d]", maxStreamPendingLimit))
+		return
+	}
+	pending, err := utils.StreamPending(c.Request.Context(), stream, group, int64(limit))
+	if err != nil {
+		renderStreamError(c, err)
+		return
+	}
+	renderData(c, pending)
+}
+
+func renderStreamError(c *gin.Context, err error) {
+	switch err {
+	case utils.ErrStreamNotFound, utils.ErrStreamGroupNotFound:
+		abortWithAppError(c, apperr.New(CodeStreamNotFound, err.Error()))
+	default:
+		abortWithAppError(c, apperr.Wrap(apperr.CodeInternal, err, "stream operation error"))
+	}
+}
@@ -6,10 +6,13 @@ require (
 	github.com/arthurkiller/rollingwriter v1.1.2
 	github.com/gin-gonic/gin v1.7.7
 	github.com/go-playground/assert/v2 v2.0.1
+	github.com/go-playground/validator/v10 v10.4.1
 	github.com/go-redis/cache/v8 v8.4.1
 	github.com/go-redis/redis/v8 v8.11.0
 	github.com/json-iterator/go v1.1.9
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/stretchr/testify v1.7.0
+	github.com/vmihailenco/go-tinylfu v0.2.0
 	go.uber.org/multierr v1.6.0
 	go.uber.org/zap v1.18.1
 	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a
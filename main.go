@@ -37,13 +37,18 @@ var (
 	appMode string
 	// 日志目录
 	logHome string
+	// 配置文件路径
+	configPath string
 	// 输出版本号
 	outputVersion bool
+	// 应用配置
+	appConfig *utils.Config
 )
 
 func init() {
 	flag.StringVar(&appMode, "appMode", DevelopmentMode, "application running mode, must in [prod,dev]")
 	flag.StringVar(&logHome, "logHome", "logs", "application log home")
+	flag.StringVar(&configPath, "config", "conf/app.json", "application config file, use default config when not exist")
 	flag.BoolVar(&outputVersion, "v", false, "print application version")
 	flag.Parse()
 
@@ -83,6 +88,31 @@ func init() {
 		zap.Bool("outToFile", outToFile),
 		zap.Int8("logLevel", int8(logLevel)),
 	)
+
+	loadConfig()
+}
+
+// loadConfig 读取配置文件初始化各组件，配置文件不存在时使用默认配置
+func loadConfig() {
+	conf, err := utils.LoadConfig(configPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Panicln("cannot load config file : ", err)
+		}
+		utils.GetLogger().Warn("config file not exist, use default config", zap.String("config", configPath))
+		conf = utils.DefaultConfig()
+	}
+	appConfig = conf
+	utils.InitRedis(conf.Redis)
+	utils.InitRedisNamed(conf.RedisInstances)
+	utils.InitRedisSubPool(conf.Subscription)
+	if err := utils.InitCache(conf.Cache); err != nil {
+		log.Panicln("invalid config cache : ", err)
+	}
+	controller.SetSecurityOptions(conf.Security)
+	if err := controller.SetErrorFormat(conf.ErrorFormat); err != nil {
+		log.Panicln("invalid config errorFormat : ", err)
+	}
 }
 
 func main() {
@@ -94,6 +124,14 @@ func main() {
 func readyClient() {
 	utils.GetRedisCli()
 	utils.GetCacheCli()
+
+	// 检查外部依赖是否可用，必需的依赖不可用时终止启动
+	deps := utils.RedisDependencies(appConfig.Dependencies)
+	if err := utils.CheckDependencies(context.Background(), deps...); err != nil {
+		utils.GetLogger().Fatal("startup dependency check failed", zap.Error(err))
+	}
+
+	utils.RegisteCacheInvalidate()
 }
 
 func listenAndServe(router *gin.Engine) {
@@ -120,7 +158,7 @@ func listenAndServe(router *gin.Engine) {
 	}()
 
 	// 等待中断信号正常关闭服务器
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall.SIGKILL but can't be catch, so don't need add it
@@ -132,6 +170,11 @@ func listenAndServe(router *gin.Engine) {
 	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
 	defer cancel()
 
+	// 等待正在执行的定时任务、队列任务与消息流消息处理结束，并主动释放领导权，其他实例无需等待租约到期即可接替
+	utils.StopScheduledJobs(ctx)
+	utils.StopQueueWorkers(ctx)
+	utils.StopStreamConsumers(ctx)
+	utils.StopLeaderElections(ctx)
 	utils.CloseRedisCli()
 
 	if err := srv.Shutdown(ctx); err != nil {
@@ -139,6 +182,11 @@ func listenAndServe(router *gin.Engine) {
 		utils.GetLogger().S.Errorf("Server forced to shutdown: %v", err)
 	}
 
+	// 等待所有受管理的 goroutine 退出
+	if err := utils.StopGoroutines(ctx); err != nil {
+		utils.GetLogger().Warn("goroutines not finished before shutdown", zap.Error(err))
+	}
+
 	utils.GetLogger().Info("Server exiting")
 
 	// 清空磁盘缓冲，关闭日志写入对象
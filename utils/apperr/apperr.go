@@ -0,0 +1,180 @@
+// Package apperr 应用错误模型，每个错误码对应固定的 HTTP 状态码，便于客户端区分错误类型
+
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Code 应用错误码
+type Code int
+
+// 通用错误码，按 HTTP 状态码 * 100 编号，业务错误码在对应状态码的区间内递增
+var (
+	CodeInvalidArgument      = Define(40000, "invalid_argument", http.StatusBadRequest, "invalid argument")
+	CodeUnauthorized         = Define(40100, "unauthorized", http.StatusUnauthorized, "unauthorized")
+	CodeForbidden            = Define(40300, "forbidden", http.StatusForbidden, "forbidden")
+	CodeNotFound             = Define(40400, "not_found", http.StatusNotFound, "resource not found")
+	CodeConflict             = Define(40900, "conflict", http.StatusConflict, "resource conflict")
+	CodePayloadTooLarge      = Define(41300, "payload_too_large", http.StatusRequestEntityTooLarge, "request body too large")
+	CodeUnsupportedMediaType = Define(41500, "unsupported_media_type", http.StatusUnsupportedMediaType, "unsupported content type")
+	CodeInternal             = Define(50000, "internal", http.StatusInternalServerError, "internal server error")
+	CodeUnavailable          = Define(50300, "unavailable", http.StatusServiceUnavailable, "service unavailable")
+)
+
+// Definition 错误码的定义
+type Definition struct {
+	Code   Code   `json:"code"`
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	// Message 未指定错误信息时使用的默认信息
+	Message string `json:"message"`
+}
+
+var (
+	definitions   = make(map[Code]*Definition)
+	definitionsMu sync.RWMutex
+)
+
+// Define 定义错误码，错误码重复时 panic
+func Define(code Code, name string, status int, message string) Code {
+	definitionsMu.Lock()
+	defer definitionsMu.Unlock()
+	if _, ok := definitions[code]; ok {
+		panic(fmt.Sprintf("apperr: code %d already defined", code))
+	}
+	definitions[code] = &Definition{Code: code, Name: name, Status: status, Message: message}
+	return code
+}
+
+// Lookup 查找错误码的定义，未定义的错误码按 CodeInternal 处理
+func Lookup(code Code) *Definition {
+	definitionsMu.RLock()
+	defer definitionsMu.RUnlock()
+	if def, ok := definitions[code]; ok {
+		return def
+	}
+	return definitions[CodeInternal]
+}
+
+// Catalog 所有已定义的错误码，按错误码排序
+func Catalog() []*Definition {
+	definitionsMu.RLock()
+	defs := make([]*Definition, 0, len(definitions))
+	for _, def := range definitions {
+		d := *def
+		defs = append(defs, &d)
+	}
+	definitionsMu.RUnlock()
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Code < defs[j].Code
+	})
+	return defs
+}
+
+// Status 错误码对应的 HTTP 状态码
+func (c Code) Status() int {
+	return Lookup(c).Status
+}
+
+// Error 应用错误
+type Error struct {
+	Code    Code
+	Message string
+	// Details 返回给客户端的错误详情
+	Details interface{}
+	// Fields 参数校验失败的字段
+	Fields []FieldError
+	// Cause 引起该错误的原始错误，只记录到日志，不返回给客户端
+	Cause error
+}
+
+// FieldError 参数校验失败的字段与原因
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// New 创建应用错误，msg 为空时使用错误码的默认信息
+func New(code Code, msg string) *Error {
+	if msg == "" {
+		msg = Lookup(code).Message
+	}
+	return &Error{Code: code, Message: msg}
+}
+
+// Newf 使用格式化的错误信息创建应用错误
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// Wrap 以 cause 为原因创建应用错误，cause 为 nil 时返回 nil
+func Wrap(code Code, cause error, msg string) *Error {
+	if cause == nil {
+		return nil
+	}
+	e := New(code, msg)
+	e.Cause = cause
+	return e
+}
+
+// WithDetails 返回携带错误详情的副本
+func (e *Error) WithDetails(details interface{}) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// WithFields 返回携带参数校验失败字段的副本
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	c := *e
+	c.Fields = fields
+	return &c
+}
+
+// Status 错误对应的 HTTP 状态码
+func (e *Error) Status() int {
+	return e.Code.Status()
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s : %s", e.Message, e.Cause.Error())
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is 错误码相同的应用错误视为同一错误
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// From 将任意错误转换为应用错误，非应用错误按 CodeInternal 处理，err 为 nil 时返回 nil
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Wrap(CodeInternal, err, "")
+}
+
+// FromStatus 根据 HTTP 状态码创建通用的应用错误，未知的状态码按 CodeInternal 处理
+func FromStatus(status int, msg string) *Error {
+	code := Code(status * 100)
+	if Lookup(code).Code != code {
+		code = CodeInternal
+	}
+	return New(code, msg)
+}
@@ -0,0 +1,55 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("testing cause")
+	err := Wrap(CodeUnavailable, cause, "")
+	assert.Equal(t, "service unavailable", err.Message)
+	assert.Equal(t, http.StatusServiceUnavailable, err.Status())
+	assert.True(t, errors.Is(err, cause))
+	assert.True(t, errors.Is(fmt.Errorf("wrapped: %w", err), New(CodeUnavailable, "")))
+	assert.False(t, errors.Is(err, New(CodeInternal, "")))
+	assert.Nil(t, Wrap(CodeInternal, nil, ""))
+
+	detailed := err.WithDetails([]string{"field"})
+	assert.Nil(t, err.Details)
+	assert.Equal(t, []string{"field"}, detailed.Details)
+
+	fields := err.WithFields(FieldError{Field: "name", Reason: "required"})
+	assert.Nil(t, err.Fields)
+	assert.Equal(t, "name", fields.Fields[0].Field)
+}
+
+func TestFrom(t *testing.T) {
+	assert.Nil(t, From(nil))
+
+	err := New(CodeNotFound, "testing not found")
+	assert.Equal(t, err, From(fmt.Errorf("wrapped: %w", err)))
+
+	internal := From(errors.New("testing error"))
+	assert.Equal(t, CodeInternal, internal.Code)
+	assert.Equal(t, http.StatusInternalServerError, internal.Status())
+
+	assert.Equal(t, CodeConflict, FromStatus(http.StatusConflict, "").Code)
+	assert.Equal(t, CodeInternal, FromStatus(http.StatusTeapot, "").Code)
+}
+
+func TestCatalog(t *testing.T) {
+	code := Define(40099, "testing", http.StatusBadRequest, "testing")
+	assert.Panics(t, func() { Define(code, "testing", http.StatusBadRequest, "testing") })
+
+	catalog := Catalog()
+	for i := 1; i < len(catalog); i++ {
+		assert.Less(t, catalog[i-1].Code, catalog[i].Code)
+	}
+	assert.Equal(t, http.StatusBadRequest, code.Status())
+	assert.Equal(t, CodeInternal, Lookup(Code(1)).Code)
+}
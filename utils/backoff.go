@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// Backoff 指数退避策略
+type Backoff struct {
+	// Initial 首次重试的等待时长
+	Initial time.Duration
+	// Max 等待时长的上限
+	Max time.Duration
+}
+
+// Duration 第 attempt 次重试（从0开始）的等待时长
+func (b Backoff) Duration(attempt int) time.Duration {
+	d := b.Initial
+	for i := 0; i < attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// sleepContext 等待指定时长，ctx 结束时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+	"go.uber.org/zap"
+)
+
+const (
+	// BreakerClosed 熔断器关闭，请求正常执行
+	BreakerClosed = "closed"
+	// BreakerOpen 熔断器打开，请求直接失败
+	BreakerOpen = "open"
+	// BreakerHalfOpen 熔断器半开，只允许少量探测请求执行
+	BreakerHalfOpen = "half-open"
+)
+
+// ErrCircuitOpen 熔断器打开时拒绝执行的错误
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerOptions 熔断器配置
+type BreakerOptions struct {
+	// Disabled 是否禁用熔断器
+	Disabled bool `json:"disabled"`
+	// Window 统计失败率的时间窗口
+	Window Duration `json:"window"`
+	// MinRequests 时间窗口内请求数达到该值后才会计算失败率
+	MinRequests int `json:"minRequests"`
+	// FailureRate 打开熔断器的失败率阈值，取值 (0, 1]
+	FailureRate float64 `json:"failureRate"`
+	// SlowThreshold 耗时超过该值的请求视为失败，为0时不按耗时判断
+	SlowThreshold Duration `json:"slowThreshold"`
+	// OpenTimeout 熔断器打开后，经过该时长进入半开状态
+	OpenTimeout Duration `json:"openTimeout"`
+	// HalfOpenRequests 半开状态允许的探测请求数，全部成功后关闭熔断器
+	HalfOpenRequests int `json:"halfOpenRequests"`
+}
+
+// DefaultBreakerOptions 默认的熔断器配置
+func DefaultBreakerOptions() *BreakerOptions {
+	return &BreakerOptions{
+		Window:           Duration(10 * time.Second),
+		MinRequests:      20,
+		FailureRate:      0.5,
+		SlowThreshold:    Duration(time.Second),
+		OpenTimeout:      Duration(5 * time.Second),
+		HalfOpenRequests: 3,
+	}
+}
+
+// UnmarshalJSON 在默认配置的基础上反序列化，未声明的项使用默认值
+func (o *BreakerOptions) UnmarshalJSON(data []byte) error {
+	type plain BreakerOptions
+	opts := (*plain)(DefaultBreakerOptions())
+	if err := json.Unmarshal(data, opts); err != nil {
+		return err
+	}
+	*o = BreakerOptions(*opts)
+	return nil
+}
+
+// BreakerStats 熔断器状态
+type BreakerStats struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// Requests、Failures 当前时间窗口内的请求数与失败数
+	Requests int `json:"requests"`
+	Failures int `json:"failures"`
+	// Opens 熔断器打开的总次数
+	Opens uint64 `json:"opens"`
+	// Rejected 被拒绝执行的总请求数
+	Rejected uint64 `json:"rejected"`
+	// OpenedAt 最近一次打开的时间
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
+
+// CircuitBreaker 熔断器
+// 关闭状态下统计时间窗口内的失败率，超过阈值后打开；打开一段时间后进入半开状态，
+// 半开状态的探测请求全部成功则关闭，任意失败则重新打开
+type CircuitBreaker struct {
+	name string
+	opts *BreakerOptions
+
+	mu          sync.Mutex
+	state       string
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	// probes、probeSuccesses 半开状态已放行的探测请求数与成功数
+	probes         int
+	probeSuccesses int
+
+	opens    uint64
+	rejected uint64
+}
+
+// NewCircuitBreaker 创建熔断器，opts 为空时使用默认配置
+func NewCircuitBreaker(name string, opts *BreakerOptions) *CircuitBreaker {
+	if opts == nil {
+		opts = DefaultBreakerOptions()
+	}
+	return &CircuitBreaker{
+		name:        name,
+		opts:        opts,
+		state:       BreakerClosed,
+		windowStart: time.Now(),
+	}
+}
+
+// Allow 请求执行前检查是否允许执行，不允许时返回 ErrCircuitOpen
+// 允许执行的请求必须在结束后调用 Record 记录结果
+func (b *CircuitBreaker) Allow() error {
+	if b.opts.Disabled {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.opts.OpenTimeout.Std() {
+			b.rejected++
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.probes, b.probeSuccesses = 0, 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.opts.HalfOpenRequests {
+			b.rejected++
+			return ErrCircuitOpen
+		}
+		b.probes++
+	default:
+		if now.Sub(b.windowStart) >= b.opts.Window.Std() {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	}
+	return nil
+}
+
+// Record 记录请求的执行结果，耗时超过 SlowThreshold 的请求同样视为失败
+func (b *CircuitBreaker) Record(elapsed time.Duration, failed bool) {
+	if b.opts.Disabled {
+		return
+	}
+	if b.opts.SlowThreshold > 0 && elapsed >= b.opts.SlowThreshold.Std() {
+		failed = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.open()
+			return
+		}
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.opts.HalfOpenRequests {
+			b.setState(BreakerClosed)
+			b.windowStart = time.Now()
+			b.requests, b.failures = 0, 0
+		}
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.opts.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.opts.FailureRate {
+			b.open()
+		}
+	}
+}
+
+// State 熔断器当前状态
+func (b *CircuitBreaker) State() string {
+	if b.opts.Disabled {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.opts.OpenTimeout.Std() {
+		// 等待下一个请求将熔断器切换为半开状态
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Stats 熔断器统计数据
+func (b *CircuitBreaker) Stats() *BreakerStats {
+	state := b.State()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := &BreakerStats{
+		Name:     b.name,
+		State:    state,
+		Requests: b.requests,
+		Failures: b.failures,
+		Opens:    b.opens,
+		Rejected: b.rejected,
+	}
+	if !b.openedAt.IsZero() {
+		openedAt := b.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
+
+// open 打开熔断器，调用方需要持有锁
+func (b *CircuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.opens++
+	b.setState(BreakerOpen)
+}
+
+// setState 切换熔断器状态，调用方需要持有锁
+func (b *CircuitBreaker) setState(state string) {
+	if b.state == state {
+		return
+	}
+	GetLogger().Warn("circuit breaker state changed",
+		zap.String("breaker", b.name),
+		zap.String("from", b.state),
+		zap.String("to", state),
+	)
+	b.state = state
+}
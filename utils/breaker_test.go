@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker("testing", &BreakerOptions{
+		Window:           Duration(time.Minute),
+		MinRequests:      4,
+		FailureRate:      0.5,
+		SlowThreshold:    Duration(100 * time.Millisecond),
+		OpenTimeout:      Duration(20 * time.Millisecond),
+		HalfOpenRequests: 2,
+	})
+
+	for _, failed := range []bool{false, true, false} {
+		assert.Nil(t, b.Allow())
+		b.Record(time.Millisecond, failed)
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+
+	// 慢请求同样计为失败
+	assert.Nil(t, b.Allow())
+	b.Record(time.Second, false)
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.Equal(t, ErrCircuitOpen, b.Allow())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.Nil(t, b.Allow())
+	assert.Nil(t, b.Allow())
+	assert.Equal(t, ErrCircuitOpen, b.Allow())
+	b.Record(time.Millisecond, false)
+	b.Record(time.Millisecond, false)
+	assert.Equal(t, BreakerClosed, b.State())
+
+	stats := b.Stats()
+	assert.Equal(t, uint64(1), stats.Opens)
+	assert.Equal(t, uint64(2), stats.Rejected)
+	assert.Equal(t, 0, stats.Requests)
+}
+
+func TestRedisBreakerHook(t *testing.T) {
+	opts := DefaultRedisOptions()
+	opts.Addrs = []string{"127.0.0.1:1"}
+	opts.DialTimeout = Duration(50 * time.Millisecond)
+	opts.MinIdleConns = 0
+	opts.Breaker = &BreakerOptions{
+		Window:           Duration(time.Minute),
+		MinRequests:      2,
+		FailureRate:      1,
+		OpenTimeout:      Duration(time.Minute),
+		HalfOpenRequests: 1,
+	}
+	client, err := newRedisClient(opts)
+	assert.Nil(t, err)
+	defer client.Close()
+	instrumentRedisClient("breaker-testing", client, opts)
+
+	ctx := context.TODO()
+	for i := 0; i < 2; i++ {
+		err = client.Get(ctx, "k").Err()
+		assert.NotNil(t, err)
+		assert.NotEqual(t, ErrCircuitOpen, err)
+	}
+	assert.Equal(t, ErrCircuitOpen, client.Get(ctx, "k").Err())
+	_, err = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Get(ctx, "k")
+		return nil
+	})
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	redisHooksMu.RLock()
+	stats := redisHooks["breaker-testing"].stats()
+	redisHooksMu.RUnlock()
+	assert.Equal(t, uint64(2), stats.Errors[redisErrCircuitOpen])
+}
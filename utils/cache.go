@@ -1,24 +1,172 @@
 package utils
 
 import (
+	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/frank-yf/go-web-example/utils/json"
 	"github.com/go-redis/cache/v8"
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 )
 
+const (
+	// CacheModeLocal 只使用本地内存缓存
+	CacheModeLocal = "local"
+	// CacheModeRedis 只使用redis缓存
+	CacheModeRedis = "redis"
+	// CacheModeTwoTier 本地内存与redis两级缓存，优先读取本地内存
+	CacheModeTwoTier = "two-tier"
+
+	// CacheMarshalerJSON 使用 utils/json 序列化缓存数据
+	CacheMarshalerJSON = "json"
+	// CacheMarshalerMsgpack 使用 go-redis/cache 默认的 msgpack 序列化缓存数据
+	CacheMarshalerMsgpack = "msgpack"
+)
+
 var (
-	cacheClient *cache.Cache
-	cacheOnce   sync.Once
+	// ErrCacheMiss 缓存中不存在指定的键
+	ErrCacheMiss = cache.ErrCacheMiss
+
+	cacheOpts *CacheOptions
+	// localCacheStore 本地缓存，redis 模式下为 nil
+	localCacheStore *localCache
+	// localCacheClient 与 cacheClient 共享同一个本地缓存，但只读写本地内存
+	localCacheClient *cache.Cache
+	cacheClient      *cache.Cache
+	cacheOnce        sync.Once
 )
 
+// CacheOptions 缓存拓扑配置
+type CacheOptions struct {
+	// Mode 缓存模式，可选 local、redis、two-tier，默认 local
+	Mode string `json:"mode"`
+	// LocalSize 本地缓存的最大条目数
+	LocalSize int `json:"localSize"`
+	// LocalTTL 本地缓存的有效期
+	LocalTTL Duration `json:"localTTL"`
+	// LocalOffset 本地缓存有效期的随机偏移上限，避免缓存集中失效
+	LocalOffset Duration `json:"localOffset"`
+	// Marshaler 缓存数据的序列化方式，可选 json、msgpack，默认 json
+	Marshaler string `json:"marshaler"`
+
+	// Marshal 自定义序列化函数，设置后忽略 Marshaler
+	Marshal cache.MarshalFunc `json:"-"`
+	// Unmarshal 自定义反序列化函数，设置后忽略 Marshaler
+	Unmarshal cache.UnmarshalFunc `json:"-"`
+}
+
+func defaultCacheOptions() *CacheOptions {
+	return &CacheOptions{
+		Mode:        CacheModeLocal,
+		LocalSize:   1000,
+		LocalTTL:    Duration(time.Minute),
+		LocalOffset: Duration(6 * time.Second),
+		Marshaler:   CacheMarshalerJSON,
+	}
+}
+
+// complete 使用默认值补全未配置的项
+func (o *CacheOptions) complete() *CacheOptions {
+	def := defaultCacheOptions()
+	if o == nil {
+		return def
+	}
+	opts := *o
+	if opts.Mode == "" {
+		opts.Mode = def.Mode
+	}
+	if opts.LocalSize <= 0 {
+		opts.LocalSize = def.LocalSize
+	}
+	if opts.LocalTTL <= 0 {
+		opts.LocalTTL = def.LocalTTL
+	}
+	if opts.LocalOffset < 0 {
+		opts.LocalOffset = 0
+	}
+	if opts.Marshaler == "" {
+		opts.Marshaler = def.Marshaler
+	}
+	return &opts
+}
+
+// CacheStats 缓存统计数据
+type CacheStats struct {
+	*cache.Stats
+	Invalidation InvalidateStats `json:"invalidation"`
+	Loader       LoaderStats     `json:"loader"`
+}
+
+// GetCacheStats 获取缓存统计数据
+func GetCacheStats() *CacheStats {
+	return &CacheStats{
+		Stats: GetCacheCli().Stats(),
+		Invalidation: InvalidateStats{
+			Published: atomic.LoadUint64(&invalidateStats.Published),
+			Received:  atomic.LoadUint64(&invalidateStats.Received),
+			Ignored:   atomic.LoadUint64(&invalidateStats.Ignored),
+			Keys:      atomic.LoadUint64(&invalidateStats.Keys),
+			Prefixes:  atomic.LoadUint64(&invalidateStats.Prefixes),
+			Flushes:   atomic.LoadUint64(&invalidateStats.Flushes),
+		},
+		Loader: LoaderStats{
+			Loads:        atomic.LoadUint64(&loaderStats.Loads),
+			LoadErrors:   atomic.LoadUint64(&loaderStats.LoadErrors),
+			Coalesced:    atomic.LoadUint64(&loaderStats.Coalesced),
+			StaleServed:  atomic.LoadUint64(&loaderStats.StaleServed),
+			Refreshes:    atomic.LoadUint64(&loaderStats.Refreshes),
+			NegativeHits: atomic.LoadUint64(&loaderStats.NegativeHits),
+		},
+	}
+}
+
+// InitCache 根据配置初始化缓存，需要在首次调用 GetCacheCli 之前执行，配置无效时返回错误
+func InitCache(opts *CacheOptions) error {
+	if opts != nil {
+		switch opts.Mode {
+		case "", CacheModeLocal, CacheModeRedis, CacheModeTwoTier:
+		default:
+			return fmt.Errorf("unknown cache mode '%s', must in [%s|%s|%s]",
+				opts.Mode, CacheModeLocal, CacheModeRedis, CacheModeTwoTier)
+		}
+		switch opts.Marshaler {
+		case "", CacheMarshalerJSON, CacheMarshalerMsgpack:
+		default:
+			return fmt.Errorf("unknown cache marshaler '%s', must in [%s|%s]",
+				opts.Marshaler, CacheMarshalerJSON, CacheMarshalerMsgpack)
+		}
+	}
+	cacheOpts = opts
+	return nil
+}
+
 func GetCacheCli() *cache.Cache {
 	cacheOnce.Do(initCacheCli)
 	return cacheClient
 }
 
+// GetLocalCacheCli 获取只使用本地内存的缓存客户端
+// 写入的数据对 GetCacheCli 的本地缓存同样可见；redis 模式下没有本地缓存，返回 nil
+func GetLocalCacheCli() *cache.Cache {
+	cacheOnce.Do(initCacheCli)
+	return localCacheClient
+}
+
+// GetAvailableCacheCli 获取当前可用的缓存客户端
+// 缓存使用的redis熔断器打开时降级为只读写本地内存的客户端，避免每次读取都等待redis失败；
+// redis 模式下没有本地缓存，仍返回 GetCacheCli
+func GetAvailableCacheCli() *cache.Cache {
+	cli := GetCacheCli()
+	if localCacheClient != nil && cacheOpts.Mode != CacheModeLocal && redisBreakerOpen(RedisNameCache) {
+		return localCacheClient
+	}
+	return cli
+}
+
 // RegisteDeleteCache 从redis中订阅清空内存缓存
 // 假如订阅事件已存在，则什么都不做
 // 异步注册，避免获取订阅连接时影响业务逻辑性能
@@ -30,18 +178,90 @@ func RegisteDeleteCache(channel string) {
 
 // DeleteCacheFromRedisMessage 根据redis订阅消息清空内存缓存
 func DeleteCacheFromRedisMessage(msg *redis.Message) {
-	GetCacheCli().DeleteFromLocalCache(msg.Payload)
+	invalidateLocalKey(msg.Payload)
 	GetLogger().Info("remove local cache",
 		zap.String("channel", msg.Channel),
 		zap.String("cacheKey", msg.Payload),
 	)
 }
 
+// CacheGet 读取缓存数据到 value 中，缓存不存在时返回 ErrCacheMiss
+func CacheGet(ctx context.Context, key string, value interface{}) error {
+	return GetAvailableCacheCli().Get(ctx, key, value)
+}
+
+// CacheSet 写入缓存，ttl 只对redis缓存生效，本地缓存使用统一配置的有效期
+// redis熔断器打开时只写入本地缓存
+func CacheSet(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return GetAvailableCacheCli().Set(&cache.Item{
+		Ctx:   ctx,
+		Key:   key,
+		Value: value,
+		TTL:   ttl,
+	})
+}
+
+// CacheOnce 读取缓存数据到 value 中，缓存不存在时调用 loader 加载数据并写入缓存
+// 同一个键并发加载时，loader 只会被执行一次
+func CacheOnce(ctx context.Context, key string, value interface{}, ttl time.Duration,
+	loader func(ctx context.Context) (interface{}, error)) error {
+	return GetAvailableCacheCli().Once(&cache.Item{
+		Ctx:   ctx,
+		Key:   key,
+		Value: value,
+		TTL:   ttl,
+		Do: func(item *cache.Item) (interface{}, error) {
+			return loader(item.Context())
+		},
+	})
+}
+
+// CacheDelete 删除缓存
+func CacheDelete(ctx context.Context, key string) error {
+	return GetCacheCli().Delete(ctx, key)
+}
+
 func initCacheCli() {
-	cacheClient = cache.New(&cache.Options{
-		//Redis:        GetRedisCli(),
-		LocalCache:   cache.NewTinyLFU(10, time.Minute),
+	opts := cacheOpts.complete()
+	cacheOpts = opts
+
+	var localCache cache.LocalCache
+	if opts.Mode != CacheModeRedis {
+		localCacheStore = newLocalCache(opts.LocalSize, opts.LocalTTL.Std(), opts.LocalOffset.Std())
+		localCache = localCacheStore
+	}
+
+	cacheOptions := &cache.Options{
+		LocalCache:   localCache,
 		StatsEnabled: true,
-	})
-	GetLogger().Info("memory cache ready...")
+		Marshal:      opts.Marshal,
+		Unmarshal:    opts.Unmarshal,
+	}
+	if opts.Marshal == nil && opts.Unmarshal == nil && opts.Marshaler == CacheMarshalerJSON {
+		cacheOptions.Marshal = json.Marshal
+		cacheOptions.Unmarshal = json.Unmarshal
+	}
+
+	switch opts.Mode {
+	case CacheModeLocal:
+	case CacheModeRedis, CacheModeTwoTier:
+		cacheOptions.Redis = cacheRedisCli()
+	default:
+		panic(fmt.Sprintf("cache mode must in [%s|%s|%s]", CacheModeLocal, CacheModeRedis, CacheModeTwoTier))
+	}
+	cacheClient = cache.New(cacheOptions)
+
+	if localCache != nil {
+		localCacheClient = cache.New(&cache.Options{
+			LocalCache: localCache,
+			Marshal:    cacheOptions.Marshal,
+			Unmarshal:  cacheOptions.Unmarshal,
+		})
+	}
+	GetLogger().Info("memory cache ready...",
+		zap.String("mode", opts.Mode),
+		zap.Int("localSize", opts.LocalSize),
+		zap.Duration("localTTL", opts.LocalTTL.Std()),
+		zap.String("marshaler", opts.Marshaler),
+	)
 }
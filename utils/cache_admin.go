@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// CacheTierLocal 本地内存缓存层
+	CacheTierLocal = "local"
+	// CacheTierRedis redis缓存层
+	CacheTierRedis = "redis"
+)
+
+var (
+	// ErrLocalCacheDisabled 当前缓存模式没有本地缓存层
+	ErrLocalCacheDisabled = errors.New("cache: local tier is disabled")
+	// ErrRedisCacheDisabled 当前缓存模式没有redis缓存层
+	ErrRedisCacheDisabled = errors.New("cache: redis tier is disabled")
+	// ErrRedisClusterScan 集群模式的键分布在多个节点，无法使用单个游标分页
+	ErrRedisClusterScan = errors.New("cache: cursor scan is not supported in redis cluster mode")
+)
+
+// CacheKeyInfo 缓存键信息
+type CacheKeyInfo struct {
+	Key string `json:"key"`
+	// Size 缓存数据的字节数，不是字符串类型的redis键为0
+	Size int64 `json:"size"`
+	// TTL 剩余有效期（毫秒），-1 表示永不过期
+	TTL int64 `json:"ttl"`
+}
+
+func localCacheEnabled() error {
+	GetCacheCli()
+	if localCacheStore == nil {
+		return ErrLocalCacheDisabled
+	}
+	return nil
+}
+
+func redisCacheEnabled() error {
+	if !cacheRedisEnabled() {
+		return ErrRedisCacheDisabled
+	}
+	return nil
+}
+
+// LocalCacheKeys 分页查看本地缓存中指定前缀的键
+func LocalCacheKeys(prefix string, offset, limit int) (infos []*CacheKeyInfo, total int, err error) {
+	if err = localCacheEnabled(); err != nil {
+		return
+	}
+	infos, total = localCacheStore.Keys(prefix, offset, limit)
+	return
+}
+
+// LocalCacheKey 查看本地缓存键的信息，键不存在时返回 ErrCacheMiss
+func LocalCacheKey(key string) (*CacheKeyInfo, error) {
+	if err := localCacheEnabled(); err != nil {
+		return nil, err
+	}
+	info, ok := localCacheStore.Inspect(key)
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return info, nil
+}
+
+// DeleteLocalCacheKey 删除本地缓存键，键不存在时返回 ErrCacheMiss
+func DeleteLocalCacheKey(key string) error {
+	if _, err := LocalCacheKey(key); err != nil {
+		return err
+	}
+	localCacheStore.Del(key)
+	return nil
+}
+
+// DeleteLocalCachePrefix 删除本地缓存中指定前缀的键，返回删除的数量
+func DeleteLocalCachePrefix(prefix string) (n int, err error) {
+	if err = localCacheEnabled(); err != nil {
+		return
+	}
+	n = localCacheStore.DelPrefix(prefix)
+	return
+}
+
+// RedisCacheKeys 使用 SCAN 游标分页查看redis中指定前缀的键，返回下一页的游标，游标为0表示遍历结束
+func RedisCacheKeys(ctx context.Context, prefix string, cursor uint64, count int64) (infos []*CacheKeyInfo, next uint64, err error) {
+	if err = redisCacheEnabled(); err != nil {
+		return
+	}
+	if _, ok := cacheRedisCli().(*redis.ClusterClient); ok {
+		err = ErrRedisClusterScan
+		return
+	}
+	keys, next, err := cacheRedisCli().Scan(ctx, cursor, escapeRedisPattern(prefix)+"*", count).Result()
+	if err != nil {
+		return
+	}
+	infos, err = redisKeyInfos(ctx, keys)
+	return
+}
+
+// RedisCacheKey 查看redis缓存键的信息，键不存在时返回 ErrCacheMiss
+func RedisCacheKey(ctx context.Context, key string) (*CacheKeyInfo, error) {
+	if err := redisCacheEnabled(); err != nil {
+		return nil, err
+	}
+	infos, err := redisKeyInfos(ctx, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, ErrCacheMiss
+	}
+	return infos[0], nil
+}
+
+// DeleteRedisCacheKey 删除redis缓存键，键不存在时返回 ErrCacheMiss
+func DeleteRedisCacheKey(ctx context.Context, key string) error {
+	if err := redisCacheEnabled(); err != nil {
+		return err
+	}
+	n, err := cacheRedisCli().Del(ctx, key).Result()
+	if err == nil && n == 0 {
+		err = ErrCacheMiss
+	}
+	return err
+}
+
+// DeleteRedisCachePrefix 删除redis中指定前缀的键，返回删除的数量
+func DeleteRedisCachePrefix(ctx context.Context, prefix string) (int64, error) {
+	if err := redisCacheEnabled(); err != nil {
+		return 0, err
+	}
+	return deleteRedisPrefix(ctx, prefix)
+}
+
+// WarmLocalCache 将redis中的缓存数据预热到本地缓存，redis中不存在时返回 ErrCacheMiss
+func WarmLocalCache(ctx context.Context, key string) (*CacheKeyInfo, error) {
+	if err := localCacheEnabled(); err != nil {
+		return nil, err
+	}
+	if err := redisCacheEnabled(); err != nil {
+		return nil, err
+	}
+	b, err := cacheRedisCli().Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	localCacheStore.Set(key, b)
+	return LocalCacheKey(key)
+}
+
+// redisKeyInfos 批量查询redis键的大小与剩余有效期，忽略已经不存在的键
+// 匹配到的键可能不是字符串类型，STRLEN 返回 WRONGTYPE 时大小记为0
+func redisKeyInfos(ctx context.Context, keys []string) ([]*CacheKeyInfo, error) {
+	infos := make([]*CacheKeyInfo, 0, len(keys))
+	if len(keys) == 0 {
+		return infos, nil
+	}
+
+	pipe := cacheRedisCli().Pipeline()
+	sizes := make([]*redis.IntCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		sizes[i] = pipe.StrLen(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	_, _ = pipe.Exec(ctx)
+
+	for i, key := range keys {
+		if err := sizes[i].Err(); err != nil && err != redis.Nil && !isRedisWrongType(err) {
+			return nil, err
+		}
+		if err := ttls[i].Err(); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		ttl := ttls[i].Val()
+		if ttl == -2 {
+			// 键已经不存在
+			continue
+		}
+		info := &CacheKeyInfo{Key: key, Size: sizes[i].Val(), TTL: -1}
+		if ttl >= 0 {
+			info.TTL = int64(ttl / time.Millisecond)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// isRedisWrongType 命令是否因为键的类型不匹配而失败
+func isRedisWrongType(err error) bool {
+	return strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
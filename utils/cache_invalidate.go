@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// CacheInvalidateChannel 本地缓存失效广播使用的订阅通道
+	CacheInvalidateChannel = "cache:invalidate"
+
+	// cacheInvalidateVersion 当前支持的失效消息版本
+	cacheInvalidateVersion = 1
+
+	invalidateOpKeys   = "keys"
+	invalidateOpPrefix = "prefix"
+	invalidateOpFlush  = "flush"
+
+	// redisScanCount 按前缀删除redis缓存时，每次 SCAN 的数量
+	redisScanCount = 500
+)
+
+var invalidateStats InvalidateStats
+
+// InvalidateStats 缓存失效统计数据
+type InvalidateStats struct {
+	// Published 发布的失效消息数
+	Published uint64 `json:"published"`
+	// Received 收到其他实例发布的失效消息数
+	Received uint64 `json:"received"`
+	// Ignored 忽略的失效消息数，包括自身发布的消息与无法识别的消息
+	Ignored uint64 `json:"ignored"`
+	// Keys 删除的本地缓存键数量，不包含本地缓存中不存在的键
+	Keys uint64 `json:"keys"`
+	// Prefixes 执行按前缀删除的次数
+	Prefixes uint64 `json:"prefixes"`
+	// Flushes 执行清空本地缓存的次数
+	Flushes uint64 `json:"flushes"`
+}
+
+// cacheInvalidateMessage 缓存失效消息
+type cacheInvalidateMessage struct {
+	Version   int      `json:"version"`
+	Op        string   `json:"op"`
+	Keys      []string `json:"keys,omitempty"`
+	Prefix    string   `json:"prefix,omitempty"`
+	Source    string   `json:"source"`
+	Timestamp int64    `json:"ts"`
+}
+
+// RegisteCacheInvalidate 订阅缓存失效广播，删除其他实例通知失效的本地缓存
+func RegisteCacheInvalidate() {
+	Go(func() {
+		GetRedisSubPool().Subscribe(nil, consumeCacheInvalidate, CacheInvalidateChannel)
+	})
+}
+
+// InvalidateKeys 删除本地与redis中的缓存键，并通知其他实例删除本地缓存
+func InvalidateKeys(ctx context.Context, keys ...string) (err error) {
+	if len(keys) == 0 {
+		return
+	}
+	for _, key := range keys {
+		invalidateLocalKey(key)
+		if err = GetCacheCli().Delete(ctx, key); err != nil {
+			return
+		}
+	}
+	return publishCacheInvalidate(ctx, &cacheInvalidateMessage{Op: invalidateOpKeys, Keys: keys})
+}
+
+// InvalidatePrefix 删除本地与redis中指定前缀的缓存键，并通知其他实例删除本地缓存
+func InvalidatePrefix(ctx context.Context, prefix string) (err error) {
+	if prefix == "" {
+		return fmt.Errorf("invalidate prefix must not be empty")
+	}
+	invalidateLocalPrefix(prefix)
+	if cacheRedisEnabled() {
+		if _, err = deleteRedisPrefix(ctx, prefix); err != nil {
+			return
+		}
+	}
+	return publishCacheInvalidate(ctx, &cacheInvalidateMessage{Op: invalidateOpPrefix, Prefix: prefix})
+}
+
+// FlushAll 清空所有实例的本地缓存，redis中的缓存数据不受影响
+func FlushAll(ctx context.Context) error {
+	flushLocal()
+	return publishCacheInvalidate(ctx, &cacheInvalidateMessage{Op: invalidateOpFlush})
+}
+
+// cacheRedisEnabled 缓存是否使用了redis
+func cacheRedisEnabled() bool {
+	GetCacheCli()
+	return cacheOpts.Mode != CacheModeLocal
+}
+
+func publishCacheInvalidate(ctx context.Context, msg *cacheInvalidateMessage) (err error) {
+	msg.Version = cacheInvalidateVersion
+	msg.Source = InstanceID()
+	msg.Timestamp = nowMillis()
+
+	payload, err := json.MarshalString(msg)
+	if err != nil {
+		return
+	}
+	if err = pubSubRedisCli().Publish(ctx, CacheInvalidateChannel, payload).Err(); err != nil {
+		return
+	}
+	atomic.AddUint64(&invalidateStats.Published, 1)
+	return
+}
+
+// consumeCacheInvalidate 处理其他实例发布的缓存失效消息
+func consumeCacheInvalidate(msg *redis.Message) {
+	var m cacheInvalidateMessage
+	if err := json.UnmarshalString(msg.Payload, &m); err != nil || m.Version < 1 || m.Version > cacheInvalidateVersion {
+		atomic.AddUint64(&invalidateStats.Ignored, 1)
+		GetLogger().Warn("ignore unknown cache invalidate message",
+			zap.String("payload", msg.Payload),
+			zap.Error(err),
+		)
+		return
+	}
+	if m.Source == InstanceID() {
+		// 自身发布的消息在发布前已经执行过
+		atomic.AddUint64(&invalidateStats.Ignored, 1)
+		return
+	}
+	atomic.AddUint64(&invalidateStats.Received, 1)
+
+	switch m.Op {
+	case invalidateOpKeys:
+		for _, key := range m.Keys {
+			invalidateLocalKey(key)
+		}
+	case invalidateOpPrefix:
+		invalidateLocalPrefix(m.Prefix)
+	case invalidateOpFlush:
+		flushLocal()
+	default:
+		atomic.AddUint64(&invalidateStats.Ignored, 1)
+		GetLogger().Warn("unknown cache invalidate operation", zap.String("op", m.Op))
+		return
+	}
+	GetLogger().Info("invalidate local cache",
+		zap.String("op", m.Op),
+		zap.String("source", m.Source),
+		zap.Strings("keys", m.Keys),
+		zap.String("prefix", m.Prefix),
+	)
+}
+
+// invalidateLocalKey 删除本地缓存键，只统计实际存在的键
+func invalidateLocalKey(key string) {
+	GetCacheCli()
+	if localCacheStore != nil && localCacheStore.Remove(key) {
+		atomic.AddUint64(&invalidateStats.Keys, 1)
+	}
+}
+
+func invalidateLocalPrefix(prefix string) {
+	GetCacheCli()
+	if localCacheStore != nil {
+		n := localCacheStore.DelPrefix(prefix)
+		atomic.AddUint64(&invalidateStats.Keys, uint64(n))
+	}
+	atomic.AddUint64(&invalidateStats.Prefixes, 1)
+}
+
+func flushLocal() {
+	GetCacheCli()
+	if localCacheStore != nil {
+		n := localCacheStore.Flush()
+		atomic.AddUint64(&invalidateStats.Keys, uint64(n))
+	}
+	atomic.AddUint64(&invalidateStats.Flushes, 1)
+}
+
+// deleteRedisPrefix 使用 SCAN 遍历并删除redis中指定前缀的键，返回删除的键数量
+// 集群模式下的键可能分布在不同的槽中，因此逐个删除
+func deleteRedisPrefix(ctx context.Context, prefix string) (n int64, err error) {
+	match := escapeRedisPattern(prefix) + "*"
+	err = forEachRedisNode(ctx, cacheRedisCli(), func(ctx context.Context, client redis.UniversalClient) error {
+		var cursor uint64
+		for {
+			keys, next, err := client.Scan(ctx, cursor, match, redisScanCount).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				cmds, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+					for _, key := range keys {
+						pipe.Unlink(ctx, key)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				for _, cmd := range cmds {
+					atomic.AddInt64(&n, cmd.(*redis.IntCmd).Val())
+				}
+			}
+			if cursor = next; cursor == 0 {
+				return nil
+			}
+		}
+	})
+	return
+}
+
+// escapeRedisPattern 转义 redis glob 模式中的特殊字符
+func escapeRedisPattern(s string) string {
+	return redisPatternReplacer.Replace(s)
+}
+
+var redisPatternReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`*`, `\*`,
+	`?`, `\?`,
+	`[`, `\[`,
+	`]`, `\]`,
+)
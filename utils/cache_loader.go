@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/cache/v8"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// defaultLoadTTL 加载数据默认的新鲜期
+	defaultLoadTTL = time.Minute
+	// cacheRefreshTimeout 后台刷新过期数据的超时时间
+	cacheRefreshTimeout = 10 * time.Second
+	// cacheLoadTimeout 合并加载数据的超时时间，加载不受发起请求的 ctx 影响
+	cacheLoadTimeout = 10 * time.Second
+)
+
+var (
+	// ErrCacheNotFound loader 返回该错误表示数据不存在，设置了 NegativeTTL 时会缓存该结果
+	ErrCacheNotFound = errors.New("cache: data not found")
+
+	loaderGroup singleflight.Group
+	loaderStats LoaderStats
+)
+
+// LoaderStats 缓存加载统计数据
+type LoaderStats struct {
+	// Loads 调用 loader 加载数据的次数
+	Loads uint64 `json:"loads"`
+	// LoadErrors loader 返回错误的次数，不包括 ErrCacheNotFound
+	LoadErrors uint64 `json:"loadErrors"`
+	// Coalesced 等待其他请求加载结果的次数，不包括实际执行加载的请求
+	Coalesced uint64 `json:"coalesced"`
+	// StaleServed 返回过期数据的次数
+	StaleServed uint64 `json:"staleServed"`
+	// Refreshes 后台刷新过期数据的次数
+	Refreshes uint64 `json:"refreshes"`
+	// NegativeHits 命中数据不存在缓存的次数
+	NegativeHits uint64 `json:"negativeHits"`
+}
+
+// LoadOptions 缓存加载配置
+type LoadOptions struct {
+	// TTL 数据的新鲜期，默认1分钟
+	TTL time.Duration
+	// StaleTTL 超过新鲜期后仍然可以返回旧数据的时长，期间在后台刷新数据
+	StaleTTL time.Duration
+	// NegativeTTL 数据不存在时的缓存时长，为0时不缓存
+	NegativeTTL time.Duration
+	// Jitter 有效期随机增加的比例，例如 0.1 表示随机增加 [0, 10%) 的时长，避免缓存集中失效
+	Jitter float64
+}
+
+func (o *LoadOptions) ttl() time.Duration {
+	if o.TTL > 0 {
+		return o.TTL
+	}
+	return defaultLoadTTL
+}
+
+// jitter 为时长增加随机偏移
+func (o *LoadOptions) jitter(d time.Duration) time.Duration {
+	if o.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	if n := int64(float64(d) * o.Jitter); n > 0 {
+		d += time.Duration(rand.Int63n(n))
+	}
+	return d
+}
+
+// loadedEntry 缓存加载的数据及其有效期
+type loadedEntry struct {
+	Data     []byte `json:"data,omitempty"`
+	NotFound bool   `json:"notFound,omitempty"`
+	// FreshUntil 新鲜期截止时间（毫秒时间戳）
+	FreshUntil int64 `json:"freshUntil"`
+	// ExpireAt 过期时间（毫秒时间戳），超过新鲜期但未过期的数据可以返回并在后台刷新
+	ExpireAt int64 `json:"expireAt"`
+}
+
+// CacheLoad 读取缓存数据到 value 中，缓存不存在时调用 loader 加载数据并写入缓存
+// 同一个键的并发加载会被合并为一次；数据超过新鲜期但仍在 StaleTTL 内时，直接返回旧数据并在后台刷新；
+// loader 返回 ErrCacheNotFound 时，在 NegativeTTL 内不会再次调用 loader
+func CacheLoad(ctx context.Context, key string, value interface{}, opts *LoadOptions,
+	loader func(ctx context.Context) (interface{}, error)) (err error) {
+	var entry loadedEntry
+	err = GetAvailableCacheCli().Get(ctx, key, &entry)
+	now := nowMillis()
+	if err == nil && now < entry.ExpireAt {
+		if entry.NotFound {
+			atomic.AddUint64(&loaderStats.NegativeHits, 1)
+		} else if now >= entry.FreshUntil {
+			atomic.AddUint64(&loaderStats.StaleServed, 1)
+			refreshCache(key, opts, loader)
+		}
+		return decodeLoadedEntry(&entry, value)
+	}
+	if err != nil && err != cache.ErrCacheMiss {
+		GetLogger().Warn("get cache error, reload it", zap.String("key", key), zap.Error(err))
+	}
+
+	// 合并的加载在独立的 ctx 中执行，避免第一个请求结束时其他等待的请求一起失败
+	// DoChan 在新的 goroutine 中执行加载，loader 的 panic 需要转换为错误，否则会导致进程退出
+	leader := false
+	ch := loaderGroup.DoChan(key, func() (v interface{}, err error) {
+		leader = true
+		defer func() {
+			if res := recover(); res != nil {
+				stack := string(debug.Stack())
+				GetLogger().Error("cache loader panic", zap.String("key", key), zap.Any("panic", res), zap.String("stack", stack))
+				err = &PanicError{Value: res, Stack: stack}
+			}
+		}()
+		loadCtx, cancel := context.WithTimeout(WithRequestID(context.Background(), RequestIDFromContext(ctx)), cacheLoadTimeout)
+		defer cancel()
+		return loadCache(loadCtx, key, opts, loader)
+	})
+	var res singleflight.Result
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if res.Shared && !leader {
+		atomic.AddUint64(&loaderStats.Coalesced, 1)
+	}
+	if res.Err != nil {
+		return res.Err
+	}
+	return decodeLoadedEntry(res.Val.(*loadedEntry), value)
+}
+
+// refreshCache 在后台刷新缓存，同一个键同时只会有一个刷新任务
+func refreshCache(key string, opts *LoadOptions, loader func(ctx context.Context) (interface{}, error)) {
+	Go(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cacheRefreshTimeout)
+		defer cancel()
+		_, err, shared := loaderGroup.Do(key, func() (interface{}, error) {
+			atomic.AddUint64(&loaderStats.Refreshes, 1)
+			return loadCache(ctx, key, opts, loader)
+		})
+		if err != nil && !shared && err != ErrCacheNotFound {
+			GetLogger().Warn("refresh stale cache error", zap.String("key", key), zap.Error(err))
+		}
+	})
+}
+
+// loadCache 调用 loader 加载数据并写入缓存
+func loadCache(ctx context.Context, key string, opts *LoadOptions,
+	loader func(ctx context.Context) (interface{}, error)) (*loadedEntry, error) {
+	atomic.AddUint64(&loaderStats.Loads, 1)
+	cli := GetAvailableCacheCli()
+	now := time.Now()
+
+	entry := new(loadedEntry)
+	var ttl time.Duration
+	v, err := loader(ctx)
+	switch {
+	case err == ErrCacheNotFound:
+		if opts.NegativeTTL <= 0 {
+			return nil, err
+		}
+		entry.NotFound = true
+		ttl = opts.jitter(opts.NegativeTTL)
+		entry.FreshUntil = toMillis(now.Add(ttl))
+	case err != nil:
+		atomic.AddUint64(&loaderStats.LoadErrors, 1)
+		return nil, err
+	default:
+		if entry.Data, err = cli.Marshal(v); err != nil {
+			return nil, err
+		}
+		ttl = opts.jitter(opts.ttl())
+		entry.FreshUntil = toMillis(now.Add(ttl))
+		ttl += opts.StaleTTL
+	}
+	entry.ExpireAt = toMillis(now.Add(ttl))
+
+	err = cli.Set(&cache.Item{
+		Ctx:   ctx,
+		Key:   key,
+		Value: entry,
+		TTL:   ttl,
+	})
+	if err != nil {
+		// 写入缓存失败不影响本次加载的结果
+		GetLogger().Warn("set loaded cache error", zap.String("key", key), zap.Error(err))
+	}
+	return entry, nil
+}
+
+func decodeLoadedEntry(entry *loadedEntry, value interface{}) error {
+	if entry.NotFound {
+		return ErrCacheNotFound
+	}
+	return GetCacheCli().Unmarshal(entry.Data, value)
+}
+
+func nowMillis() int64 {
+	return toMillis(time.Now())
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
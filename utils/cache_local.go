@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/cache/v8"
+	"github.com/vmihailenco/go-tinylfu"
+)
+
+// localCacheSamples TinyLFU 频率统计的采样数
+const localCacheSamples = 100000
+
+var _ cache.LocalCache = (*localCache)(nil)
+
+// localCache 基于 TinyLFU 的本地缓存
+// 与 cache.TinyLFU 相比额外维护了缓存键的索引，支持按前缀删除与清空
+type localCache struct {
+	mu     sync.Mutex
+	rand   *rand.Rand
+	lfu    *tinylfu.T
+	size   int
+	ttl    time.Duration
+	offset time.Duration
+
+	// entries 缓存键的索引，被 TinyLFU 淘汰的键会残留到过期后才被清理
+	entries map[string]localCacheEntry
+}
+
+type localCacheEntry struct {
+	size     int
+	expireAt time.Time
+}
+
+func newLocalCache(size int, ttl, offset time.Duration) *localCache {
+	return &localCache{
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		lfu:     tinylfu.New(size, localCacheSamples),
+		size:    size,
+		ttl:     ttl,
+		offset:  offset,
+		entries: make(map[string]localCacheEntry, size),
+	}
+}
+
+func (c *localCache) Set(key string, b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttl := c.ttl
+	if c.offset > 0 {
+		ttl += time.Duration(c.rand.Int63n(int64(c.offset)))
+	}
+	expireAt := time.Now().Add(ttl)
+
+	c.lfu.Set(&tinylfu.Item{
+		Key:      key,
+		Value:    b,
+		ExpireAt: expireAt,
+	})
+	c.entries[key] = localCacheEntry{size: len(b), expireAt: expireAt}
+	if len(c.entries) > 2*c.size {
+		c.pruneExpired()
+	}
+}
+
+func (c *localCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	val, ok := c.lfu.Get(key)
+	if !ok {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return val.([]byte), true
+}
+
+func (c *localCache) Del(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lfu.Del(key)
+	delete(c.entries, key)
+}
+
+// Remove 删除缓存键，返回键是否存在，已经被 TinyLFU 淘汰或过期的键视为不存在
+func (c *localCache) Remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.entries[key]
+	ok = ok && c.exists(key)
+	c.lfu.Del(key)
+	delete(c.entries, key)
+	return ok
+}
+
+// DelPrefix 删除指定前缀的所有缓存键，返回删除的键数量，不包含已经被 TinyLFU 淘汰或过期的键
+func (c *localCache) DelPrefix(prefix string) (n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			if c.exists(key) {
+				n++
+			}
+			c.lfu.Del(key)
+			delete(c.entries, key)
+		}
+	}
+	return
+}
+
+// Flush 清空本地缓存，返回清空前仍然存在的键数量
+func (c *localCache) Flush() (n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if c.exists(key) {
+			n++
+		}
+	}
+	c.lfu = tinylfu.New(c.size, localCacheSamples)
+	c.entries = make(map[string]localCacheEntry, c.size)
+	return
+}
+
+// pruneExpired 清理索引中已过期的键，调用方需要持有锁
+func (c *localCache) pruneExpired() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expireAt) {
+			c.lfu.Del(key)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Keys 查看指定前缀的缓存键，按键名排序后分页，返回分页数据与总数
+// 会校验索引中的键是否仍然存在，这会影响 TinyLFU 的访问频率统计
+func (c *localCache) Keys(prefix string, offset, limit int) (infos []*CacheKeyInfo, total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0)
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) && c.exists(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	total = len(keys)
+	if offset >= total {
+		return make([]*CacheKeyInfo, 0), total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	infos = make([]*CacheKeyInfo, 0, end-offset)
+	for _, key := range keys[offset:end] {
+		infos = append(infos, c.info(key))
+	}
+	return
+}
+
+// Inspect 查看缓存键的大小与剩余有效期
+func (c *localCache) Inspect(key string) (*CacheKeyInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok || !c.exists(key) {
+		return nil, false
+	}
+	return c.info(key), true
+}
+
+// exists 键是否仍然存在于 TinyLFU 中，不存在时从索引中删除，调用方需要持有锁
+func (c *localCache) exists(key string) bool {
+	if _, ok := c.lfu.Get(key); ok {
+		return true
+	}
+	delete(c.entries, key)
+	return false
+}
+
+func (c *localCache) info(key string) *CacheKeyInfo {
+	entry := c.entries[key]
+	return &CacheKeyInfo{
+		Key:  key,
+		Size: int64(entry.size),
+		TTL:  toMillis(entry.expireAt) - nowMillis(),
+	}
+}
@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheOnce(t *testing.T) {
+	ctx := context.TODO()
+	loads := 0
+	loader := func(ctx context.Context) (interface{}, error) {
+		loads++
+		return []string{"a", "b"}, nil
+	}
+
+	var v1, v2 []string
+	assert.Nil(t, CacheOnce(ctx, "testing:cache:once", &v1, time.Minute, loader))
+	assert.Nil(t, CacheOnce(ctx, "testing:cache:once", &v2, time.Minute, loader))
+	assert.Equal(t, []string{"a", "b"}, v1)
+	assert.Equal(t, v1, v2)
+	assert.Equal(t, 1, loads)
+
+	assert.Nil(t, CacheDelete(ctx, "testing:cache:once"))
+	assert.Equal(t, ErrCacheMiss, CacheGet(ctx, "testing:cache:once", &v1))
+}
+
+func TestInitCacheInvalid(t *testing.T) {
+	opts := cacheOpts
+	defer func() { cacheOpts = opts }()
+
+	assert.NotNil(t, InitCache(&CacheOptions{Marshaler: "jsno"}))
+	assert.NotNil(t, InitCache(&CacheOptions{Mode: "memory"}))
+	assert.Equal(t, opts, cacheOpts)
+	assert.Nil(t, InitCache(&CacheOptions{Marshaler: CacheMarshalerMsgpack}))
+}
+
+func TestLocalCacheDelPrefix(t *testing.T) {
+	c := newLocalCache(100, time.Minute, 0)
+	c.Set("user:1", []byte("a"))
+	c.Set("user:2", []byte("b"))
+	c.Set("order:1", []byte("c"))
+
+	assert.Equal(t, 2, c.DelPrefix("user:"))
+	_, ok := c.Get("user:1")
+	assert.False(t, ok)
+	b, ok := c.Get("order:1")
+	assert.True(t, ok)
+	assert.Equal(t, "c", string(b))
+
+	assert.Equal(t, 1, c.Flush())
+	_, ok = c.Get("order:1")
+	assert.False(t, ok)
+}
+
+func TestLocalCacheCountExisting(t *testing.T) {
+	c := newLocalCache(100, 10*time.Millisecond, 0)
+	c.Set("user:1", []byte("a"))
+	c.Set("user:2", []byte("b"))
+	time.Sleep(20 * time.Millisecond)
+	c.Set("user:3", []byte("c"))
+
+	// 已经过期的键残留在索引中，但不计入删除的键数量
+	assert.False(t, c.Remove("user:1"))
+	assert.True(t, c.Remove("user:3"))
+	assert.Equal(t, 0, c.DelPrefix("user:"))
+
+	c.Set("user:4", []byte("d"))
+	c.Set("user:5", []byte("e"))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, c.Flush())
+}
+
+func TestConsumeCacheInvalidate(t *testing.T) {
+	ctx := context.TODO()
+	assert.Nil(t, CacheSet(ctx, "testing:invalidate:1", "v", time.Minute))
+	assert.Nil(t, CacheSet(ctx, "testing:invalidate:2", "v", time.Minute))
+
+	// 忽略自身发布的消息
+	consumeCacheInvalidate(&redis.Message{
+		Channel: CacheInvalidateChannel,
+		Payload: `{"version":1,"op":"keys","keys":["testing:invalidate:1"],"source":"` + InstanceID() + `"}`,
+	})
+	var v string
+	assert.Nil(t, CacheGet(ctx, "testing:invalidate:1", &v))
+
+	consumeCacheInvalidate(&redis.Message{
+		Channel: CacheInvalidateChannel,
+		Payload: `{"version":1,"op":"prefix","prefix":"testing:invalidate:","source":"other"}`,
+	})
+	assert.Equal(t, ErrCacheMiss, CacheGet(ctx, "testing:invalidate:1", &v))
+	assert.Equal(t, ErrCacheMiss, CacheGet(ctx, "testing:invalidate:2", &v))
+	assert.True(t, GetCacheStats().Invalidation.Received > 0)
+
+	// 只统计实际删除的键
+	assert.Nil(t, CacheSet(ctx, "testing:invalidate:1", "v", time.Minute))
+	keys := GetCacheStats().Invalidation.Keys
+	consumeCacheInvalidate(&redis.Message{
+		Channel: CacheInvalidateChannel,
+		Payload: `{"version":1,"op":"keys","keys":["testing:invalidate:1","testing:invalidate:missing"],"source":"other"}`,
+	})
+	assert.Equal(t, keys+1, GetCacheStats().Invalidation.Keys)
+}
+
+func TestCacheLoad(t *testing.T) {
+	ctx := context.TODO()
+	var loads int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "value", nil
+	}
+
+	// 并发加载同一个键时只调用一次 loader
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var v string
+			assert.Nil(t, CacheLoad(ctx, "testing:load:coalesce", &v, &LoadOptions{TTL: time.Minute}, loader))
+			assert.Equal(t, "value", v)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestCacheLoadNotFound(t *testing.T) {
+	ctx := context.TODO()
+	loads := 0
+	loader := func(ctx context.Context) (interface{}, error) {
+		loads++
+		return nil, ErrCacheNotFound
+	}
+	opts := &LoadOptions{NegativeTTL: time.Minute}
+
+	var v string
+	assert.Equal(t, ErrCacheNotFound, CacheLoad(ctx, "testing:load:not_found", &v, opts, loader))
+	assert.Equal(t, ErrCacheNotFound, CacheLoad(ctx, "testing:load:not_found", &v, opts, loader))
+	assert.Equal(t, 1, loads)
+}
+
+func TestCacheLoadDetached(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		select {
+		case <-release:
+			return "value", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	key := "testing:load:detached:" + NewRequestID()
+	coalesced := atomic.LoadUint64(&loaderStats.Coalesced)
+
+	// 第一个请求结束不影响其他等待加载结果的请求
+	ctx, cancel := context.WithCancel(WithRequestID(context.Background(), "testing-request"))
+	leaderErr := make(chan error, 1)
+	go func() {
+		var v string
+		leaderErr <- CacheLoad(ctx, key, &v, &LoadOptions{}, loader)
+	}()
+	<-started
+
+	waiterErr := make(chan error, 1)
+	var v string
+	go func() {
+		waiterErr <- CacheLoad(context.TODO(), key, &v, &LoadOptions{}, loader)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, <-leaderErr)
+
+	close(release)
+	assert.Nil(t, <-waiterErr)
+	assert.Equal(t, "value", v)
+	assert.Equal(t, coalesced+1, atomic.LoadUint64(&loaderStats.Coalesced))
+}
+
+func TestRedisCacheKeysWrongType(t *testing.T) {
+	ctx := context.TODO()
+	if _, ok := PingRedis(ctx); !ok {
+		t.Skip("redis unavailable")
+	}
+	prefix := "testing:cache_keys:" + NewRequestID() + ":"
+	defer cacheRedisCli().Del(ctx, prefix+"string", prefix+"hash")
+	assert.Nil(t, cacheRedisCli().Set(ctx, prefix+"string", "value", time.Minute).Err())
+	assert.Nil(t, cacheRedisCli().HSet(ctx, prefix+"hash", "field", "value").Err())
+
+	// 不是字符串类型的键不影响查询
+	infos, err := redisKeyInfos(ctx, []string{prefix + "hash", prefix + "string", prefix + "missing"})
+	assert.Nil(t, err)
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, int64(0), infos[0].Size)
+		assert.Equal(t, int64(-1), infos[0].TTL)
+		assert.Equal(t, int64(5), infos[1].Size)
+	}
+}
@@ -1,8 +1,16 @@
 package utils
 
 import (
+	"fmt"
 	"net"
+	"os"
 	"strings"
+	"sync"
+)
+
+var (
+	instanceID     string
+	instanceIDOnce sync.Once
 )
 
 // GetInternetAddress 获取网络IP
@@ -15,3 +23,19 @@ func GetInternetAddress() (ip string, err error) {
 	ip = strings.Split(localAddr.String(), ":")[0]
 	return
 }
+
+// InstanceID 当前应用实例的唯一标识，由主机名、网络IP与进程号组成
+func InstanceID() string {
+	instanceIDOnce.Do(func() {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+		}
+		ip, err := GetInternetAddress()
+		if err != nil {
+			ip = "localhost"
+		}
+		instanceID = fmt.Sprintf("%s-%s-%d", hostname, ip, os.Getpid())
+	})
+	return instanceID
+}
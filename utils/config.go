@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+)
+
+// Config 应用配置，从 json 格式的配置文件中读取
+// 未配置的项使用各组件的默认值
+type Config struct {
+	// Redis 默认的redis连接配置
+	Redis *RedisOptions `json:"redis"`
+	// RedisInstances 命名的redis连接配置，例如 cache、pubsub，未配置的名称使用默认连接
+	RedisInstances map[string]*RedisOptions `json:"redisInstances"`
+	// Subscription redis订阅的重连配置
+	Subscription *SubscriptionOptions `json:"subscription"`
+	// Cache 缓存配置
+	Cache *CacheOptions `json:"cache"`
+	// Dependencies 启动阶段依赖检查的配置，键为依赖名称，例如 redis、redis.cache
+	Dependencies map[string]*DependencyOptions `json:"dependencies"`
+	// Security 安全响应头配置，未配置时使用默认配置
+	Security *SecurityOptions `json:"security"`
+	// ErrorFormat 错误响应的默认格式，entity 或 problem，为空时为 entity
+	// 请求头 Accept 包含 application/problem+json 时总是返回 problem 格式
+	ErrorFormat string `json:"errorFormat"`
+}
+
+// DefaultConfig 默认的应用配置
+func DefaultConfig() *Config {
+	return &Config{
+		Redis: DefaultRedisOptions(),
+	}
+}
+
+// LoadConfig 读取配置文件，配置文件中的项会覆盖默认配置
+func LoadConfig(path string) (conf *Config, err error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	conf = DefaultConfig()
+	err = json.Unmarshal(bs, conf)
+	return
+}
+
+// Duration 支持在配置文件中使用 "1m30s" 格式的字符串声明时长，同时兼容纳秒数值
+type Duration time.Duration
+
+// UnmarshalJSON 将字符串或数值反序列化为时长
+func (d *Duration) UnmarshalJSON(data []byte) (err error) {
+	var v interface{}
+	if err = json.Unmarshal(data, &v); err != nil {
+		return
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value)
+	case string:
+		var td time.Duration
+		td, err = time.ParseDuration(value)
+		*d = Duration(td)
+	default:
+		err = fmt.Errorf("invalid duration: %s", data)
+	}
+	return
+}
+
+// MarshalJSON 将时长序列化为 "1m30s" 格式的字符串
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Std 转换为标准库的时长类型
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
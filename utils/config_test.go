@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	var v struct {
+		A Duration `json:"a"`
+		B Duration `json:"b"`
+	}
+	err := json.Unmarshal([]byte(`{"a":"1m30s","b":1000}`), &v)
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Second, v.A.Std())
+	assert.Equal(t, time.Microsecond, v.B.Std())
+
+	err = json.Unmarshal([]byte(`{"a":true}`), &v)
+	assert.NotNil(t, err)
+
+	bs, err := json.Marshal(v.A)
+	assert.Nil(t, err)
+	assert.Equal(t, `"1m30s"`, string(bs))
+}
+
+func TestSecurityOptionsUnmarshalJSON(t *testing.T) {
+	var conf Config
+	err := json.Unmarshal([]byte(`{"security":{"hstsMaxAge":"1h","contentSecurityPolicy":"default-src 'self'","referrerPolicy":""}}`), &conf)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Hour, conf.Security.HSTSMaxAge.Std())
+	assert.Equal(t, "default-src 'self'", conf.Security.ContentSecurityPolicy)
+	assert.Equal(t, "", conf.Security.ReferrerPolicy)
+	// 未声明的项使用默认值
+	assert.True(t, conf.Security.HSTSIncludeSubdomains)
+	assert.Equal(t, "DENY", conf.Security.FrameOptions)
+}
@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+	"go.uber.org/zap"
+)
+
+var (
+	// degradedDependencies 启动检查失败但不是必需的依赖
+	degradedDependencies   = make(map[string]error)
+	degradedDependenciesMu sync.RWMutex
+)
+
+// DependencyOptions 启动阶段依赖检查的配置
+type DependencyOptions struct {
+	// Required 是否为必需的依赖，必需的依赖不可用时应用无法启动，否则以降级模式启动
+	Required bool `json:"required"`
+	// MaxAttempts 最多检查的次数
+	MaxAttempts int `json:"maxAttempts"`
+	// InitialBackoff 首次重试的等待时长，之后每次翻倍
+	InitialBackoff Duration `json:"initialBackoff"`
+	// MaxBackoff 重试等待时长的上限
+	MaxBackoff Duration `json:"maxBackoff"`
+	// Timeout 单次检查的超时时间
+	Timeout Duration `json:"timeout"`
+}
+
+// DefaultDependencyOptions 默认的依赖检查配置
+func DefaultDependencyOptions() *DependencyOptions {
+	return &DependencyOptions{
+		Required:       true,
+		MaxAttempts:    5,
+		InitialBackoff: Duration(500 * time.Millisecond),
+		MaxBackoff:     Duration(8 * time.Second),
+		Timeout:        Duration(3 * time.Second),
+	}
+}
+
+// UnmarshalJSON 在默认配置的基础上反序列化，未声明的项使用默认值
+func (o *DependencyOptions) UnmarshalJSON(data []byte) error {
+	type plain DependencyOptions
+	opts := (*plain)(DefaultDependencyOptions())
+	if err := json.Unmarshal(data, opts); err != nil {
+		return err
+	}
+	*o = DependencyOptions(*opts)
+	return nil
+}
+
+// Dependency 应用启动时需要检查的外部依赖
+type Dependency struct {
+	Name  string
+	Check func(ctx context.Context) error
+	Opts  *DependencyOptions
+}
+
+// RedisDependencies 所有redis客户端的依赖检查，配置的键为 redis（默认客户端）或 redis.<name>（命名客户端）
+func RedisDependencies(opts map[string]*DependencyOptions) []*Dependency {
+	names := RedisCliNames()
+	deps := make([]*Dependency, 0, len(names))
+	for _, name := range names {
+		name := name
+		depName := redisDependencyName(name)
+		deps = append(deps, &Dependency{
+			Name: depName,
+			Opts: opts[depName],
+			Check: func(ctx context.Context) error {
+				return GetRedisCliNamed(name).Ping(ctx).Err()
+			},
+		})
+	}
+	return deps
+}
+
+// CheckDependencies 依次检查依赖是否可用，不可用时按指数退避重试
+// 必需的依赖在重试耗尽后返回错误；非必需的依赖记录为降级状态，应用继续启动
+func CheckDependencies(ctx context.Context, deps ...*Dependency) error {
+	for _, dep := range deps {
+		opts := dep.Opts
+		if opts == nil {
+			opts = DefaultDependencyOptions()
+		}
+		err := checkDependency(ctx, dep, opts)
+		if err == nil {
+			continue
+		}
+		if opts.Required {
+			return fmt.Errorf("required dependency '%s' is unavailable: %w", dep.Name, err)
+		}
+		degradedDependenciesMu.Lock()
+		degradedDependencies[dep.Name] = err
+		degradedDependenciesMu.Unlock()
+		GetLogger().Warn("optional dependency is unavailable, running in degraded mode",
+			zap.String("dependency", dep.Name),
+			zap.Error(err),
+		)
+	}
+	return nil
+}
+
+// DegradedDependencies 启动检查失败的非必需依赖名称
+func DegradedDependencies() []string {
+	degradedDependenciesMu.RLock()
+	defer degradedDependenciesMu.RUnlock()
+
+	names := make([]string, 0, len(degradedDependencies))
+	for name := range degradedDependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dependencyDegraded 依赖启动检查失败的原因，依赖不是降级状态时返回 nil
+func dependencyDegraded(name string) error {
+	degradedDependenciesMu.RLock()
+	defer degradedDependenciesMu.RUnlock()
+	return degradedDependencies[name]
+}
+
+// redisDependencyName redis客户端对应的依赖名称，见 RedisDependencies
+func redisDependencyName(name string) string {
+	if name == RedisNameDefault {
+		return "redis"
+	}
+	return "redis." + name
+}
+
+func checkDependency(ctx context.Context, dep *Dependency, opts *DependencyOptions) (err error) {
+	backoff := Backoff{Initial: opts.InitialBackoff.Std(), Max: opts.MaxBackoff.Std()}
+	attempts := opts.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for i := 0; i < attempts; i++ {
+		checkCtx, cancel := context.WithTimeout(ctx, opts.Timeout.Std())
+		err = dep.Check(checkCtx)
+		cancel()
+		if err == nil {
+			GetLogger().Info("dependency is ready", zap.String("dependency", dep.Name), zap.Int("attempts", i+1))
+			return
+		}
+		if i == attempts-1 {
+			break
+		}
+		wait := backoff.Duration(i)
+		GetLogger().Warn("dependency is not ready, retry later",
+			zap.String("dependency", dep.Name),
+			zap.Int("attempt", i+1),
+			zap.Duration("backoff", wait),
+			zap.Error(err),
+		)
+		if !sleepContext(ctx, wait) {
+			return ctx.Err()
+		}
+	}
+	return
+}
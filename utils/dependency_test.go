@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second}
+	assert.Equal(t, 100*time.Millisecond, b.Duration(0))
+	assert.Equal(t, 400*time.Millisecond, b.Duration(2))
+	assert.Equal(t, time.Second, b.Duration(10))
+}
+
+func TestCheckDependencies(t *testing.T) {
+	ctx := context.TODO()
+	opts := &DependencyOptions{
+		Required:       true,
+		MaxAttempts:    3,
+		InitialBackoff: Duration(time.Millisecond),
+		MaxBackoff:     Duration(time.Millisecond),
+		Timeout:        Duration(time.Second),
+	}
+
+	attempts := 0
+	flaky := &Dependency{Name: "flaky", Opts: opts, Check: func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("not ready")
+		}
+		return nil
+	}}
+	assert.Nil(t, CheckDependencies(ctx, flaky))
+	assert.Equal(t, 3, attempts)
+
+	down := &Dependency{Name: "down", Opts: opts, Check: func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}}
+	assert.NotNil(t, CheckDependencies(ctx, down))
+
+	optional := *opts
+	optional.Required = false
+	down.Opts = &optional
+	assert.Nil(t, CheckDependencies(ctx, down))
+	assert.Equal(t, []string{"down"}, DegradedDependencies())
+}
+
+func TestRedisHealthDegraded(t *testing.T) {
+	degradedDependenciesMu.Lock()
+	degradedDependencies["redis"] = errors.New("connection refused")
+	degradedDependenciesMu.Unlock()
+	defer func() {
+		degradedDependenciesMu.Lock()
+		delete(degradedDependencies, "redis")
+		degradedDependenciesMu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	health, _ := RedisHealth(ctx)
+	assert.Equal(t, "connection refused", health[RedisNameDefault].Degraded)
+}
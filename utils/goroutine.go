@@ -4,39 +4,311 @@ package utils
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"go.uber.org/multierr"
-	"golang.org/x/sync/errgroup"
+	"go.uber.org/zap"
 )
 
+const (
+	// GoroutineRunning goroutine 正在运行
+	GoroutineRunning = "running"
+	// GoroutineRestarting goroutine 异常退出，正在等待重启
+	GoroutineRestarting = "restarting"
+)
+
+// defaultSupervisor 所有通过本工具类创建的 goroutine 都由其管理
+var defaultSupervisor = newSupervisor()
+
+// SuperviseOptions goroutine 的重启配置
+type SuperviseOptions struct {
+	// Restart 为 true 时，goroutine 发生 panic 或返回错误后按退避策略重启
+	Restart bool `json:"restart"`
+	// InitialBackoff、MaxBackoff 重启的退避等待时长与上限
+	InitialBackoff Duration `json:"initialBackoff"`
+	MaxBackoff     Duration `json:"maxBackoff"`
+	// MaxRestarts 连续重启的次数上限，为0时不限制；运行时长超过 MaxBackoff 后重新计算连续重启次数与退避时长
+	MaxRestarts int `json:"maxRestarts"`
+}
+
+// complete 使用默认值补全未配置的项
+func (o *SuperviseOptions) complete() *SuperviseOptions {
+	opts := SuperviseOptions{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = Duration(time.Second)
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = Duration(time.Minute)
+	}
+	return &opts
+}
+
+// GoroutineInfo 受管理的 goroutine 的运行状态
+type GoroutineInfo struct {
+	ID        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	StartedAt time.Time `json:"startedAt"`
+	Restarts  int       `json:"restarts"`
+	Panics    int       `json:"panics"`
+	// LastPanic 最近一次 panic 的值与调用栈
+	LastPanic string `json:"lastPanic,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// GoroutineStats goroutine 统计数据
+type GoroutineStats struct {
+	// Total 进程中所有的 goroutine 数量，包括不受管理的 goroutine
+	Total int `json:"total"`
+	// Managed 受管理的 goroutine 数量
+	Managed int `json:"managed"`
+	// Started、Panics 启动以来创建的受管理 goroutine 数量与 panic 次数
+	Started    uint64           `json:"started"`
+	Panics     uint64           `json:"panics"`
+	Goroutines []*GoroutineInfo `json:"goroutines"`
+}
+
 // Go 统一的 goroutine 创建，避免因为 panic 导致主进程退出
+// goroutine 以函数名称命名，服务关闭时会等待其结束
 func Go(f func()) {
-	go func() {
-		defer func() {
-			res := recover()
-			if res != nil {
-				GetLogger().S.Error("panic: %+v", res)
-			}
-		}()
+	defaultSupervisor.start(funcName(f), nil, func(context.Context) error {
 		f()
+		return nil
+	})
+}
+
+// GoNamed 创建命名的 goroutine，ctx 在服务关闭时结束
+func GoNamed(name string, f func(ctx context.Context)) {
+	defaultSupervisor.start(name, nil, func(ctx context.Context) error {
+		f(ctx)
+		return nil
+	})
+}
+
+// Supervise 创建命名的 goroutine，发生 panic 或返回错误时按 opts 决定是否重启，ctx 在服务关闭时结束
+func Supervise(name string, opts *SuperviseOptions, f func(ctx context.Context) error) {
+	defaultSupervisor.start(name, opts.complete(), f)
+}
+
+// Goroutines 受管理的 goroutine 的运行状态，按创建顺序排序
+func Goroutines() *GoroutineStats {
+	return defaultSupervisor.stats()
+}
+
+// StopGoroutines 结束所有受管理 goroutine 的 ctx，并等待其退出，ctx 结束时返回仍在运行的 goroutine
+func StopGoroutines(ctx context.Context) error {
+	return defaultSupervisor.stop(ctx)
+}
+
+// supervisor 记录受管理的 goroutine，服务关闭时结束其 ctx 并等待退出
+type supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.Mutex
+	seq        uint64
+	goroutines map[uint64]*managedGoroutine
+
+	started uint64
+	panics  uint64
+}
+
+func newSupervisor() *supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &supervisor{
+		ctx:        ctx,
+		cancel:     cancel,
+		goroutines: make(map[uint64]*managedGoroutine),
+	}
+}
+
+// managedGoroutine 受管理的 goroutine
+type managedGoroutine struct {
+	id        uint64
+	name      string
+	opts      *SuperviseOptions
+	startedAt time.Time
+
+	mu        sync.Mutex
+	state     string
+	restarts  int
+	panics    int
+	lastPanic string
+	lastError string
+}
+
+func (s *supervisor) start(name string, opts *SuperviseOptions, f func(ctx context.Context) error) {
+	if opts == nil {
+		opts = &SuperviseOptions{}
+	}
+	s.mu.Lock()
+	s.seq++
+	g := &managedGoroutine{
+		id:        s.seq,
+		name:      name,
+		opts:      opts,
+		startedAt: time.Now(),
+		state:     GoroutineRunning,
+	}
+	s.goroutines[g.id] = g
+	s.mu.Unlock()
+	atomic.AddUint64(&s.started, 1)
+
+	s.wg.Add(1)
+	go s.run(g, f)
+}
+
+// run 执行 goroutine，按重启配置在异常退出后重启
+func (s *supervisor) run(g *managedGoroutine, f func(ctx context.Context) error) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.goroutines, g.id)
+		s.mu.Unlock()
+	}()
+
+	backoff := Backoff{Initial: g.opts.InitialBackoff.Std(), Max: g.opts.MaxBackoff.Std()}
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		err := s.call(g, f)
+		if err == nil || !g.opts.Restart || s.ctx.Err() != nil {
+			return
+		}
+		// 正常运行过一段时间后退出的不计入连续重启
+		if time.Since(start) > g.opts.MaxBackoff.Std() {
+			attempt = 0
+		}
+		if g.opts.MaxRestarts > 0 && attempt >= g.opts.MaxRestarts {
+			GetLogger().Error("goroutine restarts exceeded",
+				zap.String("name", g.name),
+				zap.Int("restarts", attempt),
+				zap.Error(err),
+			)
+			return
+		}
+
+		wait := backoff.Duration(attempt)
+		g.setState(GoroutineRestarting)
+		GetLogger().Warn("goroutine exited, restart later",
+			zap.String("name", g.name),
+			zap.Duration("backoff", wait),
+			zap.Error(err),
+		)
+		if !sleepContext(s.ctx, wait) {
+			return
+		}
+		g.mu.Lock()
+		g.state = GoroutineRunning
+		g.restarts++
+		g.mu.Unlock()
+	}
+}
+
+// call 执行一次 goroutine 函数，将 panic 转换为错误并记录调用栈
+func (s *supervisor) call(g *managedGoroutine, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if res := recover(); res != nil {
+			stack := string(debug.Stack())
+			atomic.AddUint64(&s.panics, 1)
+			g.mu.Lock()
+			g.panics++
+			g.lastPanic = fmt.Sprintf("%+v\n%s", res, stack)
+			g.mu.Unlock()
+			GetLogger().Error("goroutine panic",
+				zap.String("name", g.name),
+				zap.Any("panic", res),
+				zap.String("stack", stack),
+			)
+			err = fmt.Errorf("panic: %+v", res)
+		}
 	}()
+	if err = f(s.ctx); err != nil {
+		g.mu.Lock()
+		g.lastError = err.Error()
+		g.mu.Unlock()
+	}
+	return
 }
 
-// GoWithGroup 使用 errgroup 创建 goroutine
-func GoWithGroup(f func() error) (func() error, context.Context) {
-	g, ctx := errgroup.WithContext(context.Background())
-	g.Go(func() (err error) {
-		defer func() {
-			res := recover()
-			if res != nil {
-				GetLogger().S.Error("panic: %+v", res)
-			}
-			if e, ok := res.(error); ok {
-				err = multierr.Append(err, e)
-			}
-		}()
-		err = f()
-		return
+func (s *supervisor) stats() *GoroutineStats {
+	s.mu.Lock()
+	infos := make([]*GoroutineInfo, 0, len(s.goroutines))
+	for _, g := range s.goroutines {
+		infos = append(infos, g.info())
+	}
+	s.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
 	})
-	return g.Wait, ctx
+	return &GoroutineStats{
+		Total:      runtime.NumGoroutine(),
+		Managed:    len(infos),
+		Started:    atomic.LoadUint64(&s.started),
+		Panics:     atomic.LoadUint64(&s.panics),
+		Goroutines: infos,
+	}
+}
+
+func (s *supervisor) stop(ctx context.Context) error {
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	names := make([]string, 0, len(s.goroutines))
+	for _, g := range s.goroutines {
+		names = append(names, g.name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+	return fmt.Errorf("%d goroutines still running: %s", len(names), strings.Join(names, ", "))
+}
+
+func (g *managedGoroutine) setState(state string) {
+	g.mu.Lock()
+	g.state = state
+	g.mu.Unlock()
+}
+
+func (g *managedGoroutine) info() *GoroutineInfo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return &GoroutineInfo{
+		ID:        g.id,
+		Name:      g.name,
+		State:     g.state,
+		StartedAt: g.startedAt,
+		Restarts:  g.restarts,
+		Panics:    g.panics,
+		LastPanic: g.lastPanic,
+		LastError: g.lastError,
+	}
+}
+
+// funcName 函数的完整名称，用于命名通过 Go 创建的 goroutine
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	return fn.Name()
 }
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupervisor(t *testing.T) {
+	s := newSupervisor()
+	release := make(chan struct{})
+	s.start("testing:block", nil, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	s.start("testing:ctx", nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	s.start("testing:panic", nil, func(context.Context) error {
+		panic("testing panic")
+	})
+
+	assert.Eventually(t, func() bool { return s.stats().Managed == 2 }, time.Second, 5*time.Millisecond)
+	stats := s.stats()
+	assert.Equal(t, uint64(3), stats.Started)
+	assert.Equal(t, uint64(1), stats.Panics)
+	assert.Equal(t, "testing:block", stats.Goroutines[0].Name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := s.stop(ctx)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "testing:block"))
+	assert.False(t, strings.Contains(err.Error(), "testing:ctx"))
+
+	close(release)
+	assert.Nil(t, s.stop(context.Background()))
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	s := newSupervisor()
+	var calls int32
+	done := make(chan struct{})
+	s.start("testing:restart", (&SuperviseOptions{
+		Restart:        true,
+		InitialBackoff: Duration(time.Millisecond),
+		MaxRestarts:    3,
+	}).complete(), func(context.Context) error {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			panic("testing panic")
+		case 2:
+			return errors.New("testing error")
+		}
+		close(done)
+		return nil
+	})
+	<-done
+	assert.Nil(t, s.stop(context.Background()))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, uint64(1), s.stats().Panics)
+
+	// 超过重启次数后不再重启
+	s = newSupervisor()
+	calls = 0
+	s.start("testing:failed", (&SuperviseOptions{
+		Restart:        true,
+		InitialBackoff: Duration(time.Millisecond),
+		MaxRestarts:    2,
+	}).complete(), func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("testing error")
+	})
+	assert.Eventually(t, func() bool { return s.stats().Managed == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// 运行时长超过 MaxBackoff 后重新计算连续重启次数
+	s = newSupervisor()
+	calls = 0
+	done = make(chan struct{})
+	s.start("testing:healthy", (&SuperviseOptions{
+		Restart:        true,
+		InitialBackoff: Duration(time.Millisecond),
+		MaxBackoff:     Duration(5 * time.Millisecond),
+		MaxRestarts:    1,
+	}).complete(), func(context.Context) error {
+		if atomic.AddInt32(&calls, 1) == 4 {
+			close(done)
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+		return errors.New("testing error")
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("goroutine not restarted")
+	}
+	assert.Nil(t, s.stop(context.Background()))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestFuncName(t *testing.T) {
+	assert.True(t, strings.HasSuffix(funcName(TestFuncName), "utils.TestFuncName"))
+}
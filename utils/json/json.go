@@ -7,6 +7,9 @@ import (
 	"encoding/json"
 )
 
+// RawMessage is exported by utils/json package.
+type RawMessage = json.RawMessage
+
 var (
 	// Marshal is exported by utils/json package.
 	Marshal = json.Marshal
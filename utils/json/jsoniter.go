@@ -7,6 +7,9 @@ import (
 	jsoniter "github.com/json-iterator/go"
 )
 
+// RawMessage is exported by utils/json package.
+type RawMessage = jsoniter.RawMessage
+
 var (
 	json = jsoniter.ConfigCompatibleWithStandardLibrary
 	// Marshal is exported by utils/json package.
@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// leaderLockPrefix 选举使用的分布式锁名称前缀
+	leaderLockPrefix = "leader:"
+	// leaderReleaseTimeout 停止选举时释放领导权的最长等待时间
+	leaderReleaseTimeout = 3 * time.Second
+)
+
+var (
+	// ErrLeaderElectionExists 同名的选举已经在当前进程中启动
+	ErrLeaderElectionExists = errors.New("leader election already exists")
+
+	leaderElections   = make(map[string]*LeaderElection)
+	leaderElectionsMu sync.Mutex
+)
+
+// LeaderElectionOptions 选举配置
+type LeaderElectionOptions struct {
+	// Lease 领导权的租约时长，leader 每隔 Lease/3 续约，异常退出后其他实例最晚在租约到期后接替
+	Lease Duration `json:"lease"`
+	// RetryInterval 非 leader 实例尝试获取领导权的间隔
+	RetryInterval Duration `json:"retryInterval"`
+}
+
+// complete 使用默认值补全未配置的项
+func (o *LeaderElectionOptions) complete() *LeaderElectionOptions {
+	opts := LeaderElectionOptions{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = Duration(15 * time.Second)
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = opts.Lease / 3
+	}
+	return &opts
+}
+
+// LeaderCallbacks 领导权变化时的回调
+type LeaderCallbacks struct {
+	// OnElected 成为 leader 后在新的 goroutine 中执行，ctx 在失去领导权时结束
+	OnElected func(ctx context.Context)
+	// OnRevoked 失去领导权（租约丢失或停止选举）后执行
+	OnRevoked func()
+}
+
+// LeaderInfo 选举状态
+type LeaderInfo struct {
+	Name string `json:"name"`
+	// Identity 当前实例，见 InstanceID
+	Identity string `json:"identity"`
+	// Leader 当前的 leader 实例，没有 leader 或查询失败时为空
+	Leader   string `json:"leader"`
+	IsLeader bool   `json:"isLeader"`
+	// Term 当前实例获得领导权时的锁令牌，每次选举递增
+	Term        int64      `json:"term,omitempty"`
+	LeaderSince *time.Time `json:"leaderSince,omitempty"`
+	// Elected 当前实例成为 leader 的次数
+	Elected   uint64 `json:"elected"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// LeaderElection 基于redis分布式锁的 leader 选举，同一时刻最多只有一个实例持有领导权
+type LeaderElection struct {
+	name      string
+	opts      *LeaderElectionOptions
+	callbacks LeaderCallbacks
+
+	mu        sync.Mutex
+	lock      *Lock
+	since     time.Time
+	lastError string
+	elected   uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartLeaderElection 启动选举，当前进程中同名的选举已经存在时返回 ErrLeaderElectionExists
+func StartLeaderElection(name string, opts *LeaderElectionOptions, callbacks LeaderCallbacks) (*LeaderElection, error) {
+	leaderElectionsMu.Lock()
+	defer leaderElectionsMu.Unlock()
+	if _, ok := leaderElections[name]; ok {
+		return nil, ErrLeaderElectionExists
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &LeaderElection{
+		name:      name,
+		opts:      opts.complete(),
+		callbacks: callbacks,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	leaderElections[name] = e
+	Go(e.run)
+	GetLogger().Info("leader election started", zap.String("name", name), zap.String("identity", InstanceID()))
+	return e, nil
+}
+
+// LeaderElections 当前进程中所有选举的状态，按名称排序
+func LeaderElections(ctx context.Context) []*LeaderInfo {
+	leaderElectionsMu.Lock()
+	elections := make([]*LeaderElection, 0, len(leaderElections))
+	for _, e := range leaderElections {
+		elections = append(elections, e)
+	}
+	leaderElectionsMu.Unlock()
+
+	infos := make([]*LeaderInfo, 0, len(elections))
+	for _, e := range elections {
+		infos = append(infos, e.Info(ctx))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// StopLeaderElections 停止所有选举，leader 主动释放领导权以便其他实例尽快接替
+func StopLeaderElections(ctx context.Context) {
+	leaderElectionsMu.Lock()
+	elections := make([]*LeaderElection, 0, len(leaderElections))
+	for _, e := range leaderElections {
+		elections = append(elections, e)
+	}
+	leaderElectionsMu.Unlock()
+
+	for _, e := range elections {
+		e.Stop(ctx)
+	}
+}
+
+// IsLeader 当前实例是否持有领导权
+func (e *LeaderElection) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lock != nil
+}
+
+// Stop 停止选举，当前实例是 leader 时释放领导权，等待 OnRevoked 执行完成或 ctx 结束
+func (e *LeaderElection) Stop(ctx context.Context) {
+	e.cancel()
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		GetLogger().Warn("stop leader election timeout", zap.String("name", e.name))
+	}
+
+	leaderElectionsMu.Lock()
+	if leaderElections[e.name] == e {
+		delete(leaderElections, e.name)
+	}
+	leaderElectionsMu.Unlock()
+}
+
+// Info 选举状态，当前的 leader 实例从redis中查询
+func (e *LeaderElection) Info(ctx context.Context) *LeaderInfo {
+	e.mu.Lock()
+	info := &LeaderInfo{
+		Name:      e.name,
+		Identity:  InstanceID(),
+		Elected:   atomic.LoadUint64(&e.elected),
+		LastError: e.lastError,
+	}
+	if e.lock != nil {
+		since := e.since
+		info.IsLeader = true
+		info.Term = e.lock.Token()
+		info.LeaderSince = &since
+	}
+	e.mu.Unlock()
+
+	leader, err := LockOwner(ctx, leaderLockPrefix+e.name)
+	if err != nil && info.IsLeader {
+		leader = info.Identity
+	}
+	info.Leader = leader
+	return info
+}
+
+// run 循环尝试获取领导权，成为 leader 后持有到租约丢失或停止选举
+func (e *LeaderElection) run() {
+	defer close(e.done)
+	lockOpts := &LockOptions{TTL: e.opts.Lease, AutoRenew: true}
+	for e.ctx.Err() == nil {
+		l, err := TryLock(e.ctx, leaderLockPrefix+e.name, lockOpts)
+		switch {
+		case err == nil:
+			e.lead(l)
+		case err != ErrLockNotAcquired && e.ctx.Err() == nil:
+			e.mu.Lock()
+			e.lastError = err.Error()
+			e.mu.Unlock()
+			GetLogger().Warn("leader election error", zap.String("name", e.name), zap.Error(err))
+		}
+		if !sleepContext(e.ctx, e.opts.RetryInterval.Std()) {
+			return
+		}
+	}
+}
+
+// lead 持有领导权直到租约丢失或停止选举
+func (e *LeaderElection) lead(l *Lock) {
+	e.mu.Lock()
+	e.lock, e.since = l, time.Now()
+	e.mu.Unlock()
+	atomic.AddUint64(&e.elected, 1)
+	GetLogger().Info("elected as leader", zap.String("name", e.name), zap.Int64("term", l.Token()))
+
+	ctx, cancel := context.WithCancel(e.ctx)
+	if e.callbacks.OnElected != nil {
+		Go(func() {
+			e.callbacks.OnElected(ctx)
+		})
+	}
+	select {
+	case <-l.Done():
+		GetLogger().Warn("leadership lost", zap.String("name", e.name), zap.Int64("term", l.Token()))
+	case <-e.ctx.Done():
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), leaderReleaseTimeout)
+		if err := l.Release(releaseCtx); err != nil {
+			GetLogger().Warn("release leadership error", zap.String("name", e.name), zap.Error(err))
+		}
+		releaseCancel()
+		GetLogger().Info("leader stepped down", zap.String("name", e.name), zap.Int64("term", l.Token()))
+	}
+	cancel()
+
+	e.mu.Lock()
+	e.lock = nil
+	e.mu.Unlock()
+	if e.callbacks.OnRevoked != nil {
+		e.callbacks.OnRevoked()
+	}
+}
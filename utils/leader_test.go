@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaderElectionOptionsComplete(t *testing.T) {
+	opts := (*LeaderElectionOptions)(nil).complete()
+	assert.Equal(t, Duration(15*time.Second), opts.Lease)
+	assert.Equal(t, Duration(5*time.Second), opts.RetryInterval)
+}
+
+func TestLeaderElection(t *testing.T) {
+	ctx := context.TODO()
+	elected, revoked := make(chan struct{}), make(chan struct{})
+	e, err := StartLeaderElection("testing", &LeaderElectionOptions{
+		Lease:         Duration(300 * time.Millisecond),
+		RetryInterval: Duration(50 * time.Millisecond),
+	}, LeaderCallbacks{
+		OnElected: func(ctx context.Context) { close(elected) },
+		OnRevoked: func() { close(revoked) },
+	})
+	assert.Nil(t, err)
+	_, err = StartLeaderElection("testing", nil, LeaderCallbacks{})
+	assert.Equal(t, ErrLeaderElectionExists, err)
+
+	if _, ok := PingRedis(ctx); ok {
+		<-elected
+		assert.True(t, e.IsLeader())
+		info := LeaderElections(ctx)
+		assert.Len(t, info, 1)
+		assert.Equal(t, InstanceID(), info[0].Leader)
+		assert.True(t, info[0].IsLeader)
+
+		StopLeaderElections(ctx)
+		<-revoked
+		leader, err := LockOwner(ctx, leaderLockPrefix+"testing")
+		assert.Nil(t, err)
+		assert.Empty(t, leader)
+	} else {
+		assert.Eventually(t, func() bool { return e.Info(ctx).LastError != "" }, time.Second, 10*time.Millisecond)
+		assert.False(t, e.IsLeader())
+		StopLeaderElections(ctx)
+	}
+	assert.Empty(t, LeaderElections(ctx))
+}
@@ -0,0 +1,319 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// lockKeyPrefix 分布式锁在redis中的键前缀，锁名称使用 hash tag 保证锁与令牌计数在集群的同一个槽位
+const lockKeyPrefix = "lock:"
+
+var (
+	// ErrLockNotAcquired 锁已被其他持有者占用
+	ErrLockNotAcquired = errors.New("lock not acquired")
+	// ErrLockNotHeld 锁已经过期或被其他持有者获取
+	ErrLockNotHeld = errors.New("lock not held")
+
+	// heldLocks 当前进程持有的锁
+	heldLocks sync.Map
+
+	// lockAcquireScript 获取锁成功后递增并返回令牌，失败时返回0
+	lockAcquireScript = redis.NewScript(`
+if redis.call('set', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('incr', KEYS[2])
+end
+return 0`)
+	// lockReleaseScript 只释放自己持有的锁
+	lockReleaseScript = redis.NewScript(`
+if redis.call('get', KEYS[1]) == ARGV[1] then
+	return redis.call('del', KEYS[1])
+end
+return 0`)
+	// lockExtendScript 只延长自己持有的锁
+	lockExtendScript = redis.NewScript(`
+if redis.call('get', KEYS[1]) == ARGV[1] then
+	return redis.call('pexpire', KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// LockOptions 分布式锁配置
+type LockOptions struct {
+	// TTL 锁的过期时间，持有者异常退出后锁在过期后自动释放
+	TTL Duration `json:"ttl"`
+	// AutoRenew 是否在后台每隔 TTL/3 自动续期，直到释放锁
+	AutoRenew bool `json:"autoRenew"`
+	// InitialBackoff、MaxBackoff 阻塞获取锁时的重试等待时长与上限
+	InitialBackoff Duration `json:"initialBackoff"`
+	MaxBackoff     Duration `json:"maxBackoff"`
+}
+
+func defaultLockOptions() *LockOptions {
+	return &LockOptions{
+		TTL:            Duration(30 * time.Second),
+		InitialBackoff: Duration(50 * time.Millisecond),
+		MaxBackoff:     Duration(time.Second),
+	}
+}
+
+// complete 使用默认值补全未配置的项
+func (o *LockOptions) complete() *LockOptions {
+	def := defaultLockOptions()
+	if o == nil {
+		return def
+	}
+	opts := *o
+	if opts.TTL <= 0 {
+		opts.TTL = def.TTL
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = def.InitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = def.MaxBackoff
+	}
+	return &opts
+}
+
+// LockInfo 当前进程持有的锁
+type LockInfo struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// Token 获取锁时分配的递增令牌，写入共享资源时携带令牌，资源方拒绝比已见过的令牌更小的写入
+	Token      int64     `json:"token"`
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	ExpireAt   time.Time `json:"expireAt"`
+	AutoRenew  bool      `json:"autoRenew"`
+	// Renewals 自动续期的次数
+	Renewals uint64 `json:"renewals"`
+}
+
+// Lock 基于redis的分布式锁
+type Lock struct {
+	name  string
+	key   string
+	owner string
+	token int64
+	opts  *LockOptions
+
+	acquiredAt time.Time
+	expireAt   int64
+	renewals   uint64
+	released   int32
+
+	// ctx 在释放锁或锁丢失时结束
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// TryLock 尝试获取锁，锁已被占用时立即返回 ErrLockNotAcquired，opts 为空时使用默认配置
+func TryLock(ctx context.Context, name string, opts *LockOptions) (*Lock, error) {
+	opts = opts.complete()
+	l := &Lock{
+		name:  name,
+		key:   lockKey(name),
+		owner: InstanceID() + ":" + NewRequestID(),
+		opts:  opts,
+	}
+	ttl := opts.TTL.Std()
+	start := time.Now()
+	token, err := lockAcquireScript.Run(ctx, GetRedisCli(), []string{l.key, l.key + ":token"},
+		l.owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if token == 0 {
+		return nil, ErrLockNotAcquired
+	}
+	l.token = token
+	l.acquiredAt = start
+	atomic.StoreInt64(&l.expireAt, start.Add(ttl).UnixNano())
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+	heldLocks.Store(l, struct{}{})
+
+	if opts.AutoRenew {
+		Go(l.watchdog)
+	}
+	GetLogger().Debug("lock acquired", zap.String("name", name), zap.Int64("token", token))
+	return l, nil
+}
+
+// AcquireLock 阻塞获取锁，锁已被占用时按退避策略重试，直到获取成功或 ctx 结束
+func AcquireLock(ctx context.Context, name string, opts *LockOptions) (*Lock, error) {
+	opts = opts.complete()
+	backoff := Backoff{Initial: opts.InitialBackoff.Std(), Max: opts.MaxBackoff.Std()}
+	for attempt := 0; ; attempt++ {
+		l, err := TryLock(ctx, name, opts)
+		if err != ErrLockNotAcquired {
+			return l, err
+		}
+		if !sleepContext(ctx, backoff.Duration(attempt)) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// LockOwner 查询持有锁的实例，见 InstanceID，锁未被持有时返回空字符串
+func LockOwner(ctx context.Context, name string) (string, error) {
+	owner, err := GetRedisCli().Get(ctx, lockKey(name)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// 持有者标识由实例ID与随机后缀组成
+	if i := strings.LastIndex(owner, ":"); i >= 0 {
+		owner = owner[:i]
+	}
+	return owner, nil
+}
+
+// lockKey 锁在redis中的键
+func lockKey(name string) string {
+	return lockKeyPrefix + "{" + name + "}"
+}
+
+// HeldLocks 当前进程持有的锁，按名称排序
+func HeldLocks() []*LockInfo {
+	locks := make([]*LockInfo, 0)
+	heldLocks.Range(func(k, _ interface{}) bool {
+		locks = append(locks, k.(*Lock).info())
+		return true
+	})
+	sort.Slice(locks, func(i, j int) bool {
+		if locks[i].Name != locks[j].Name {
+			return locks[i].Name < locks[j].Name
+		}
+		return locks[i].Token < locks[j].Token
+	})
+	return locks
+}
+
+// Name 锁名称
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Token 获取锁时分配的令牌，同名锁每次获取时递增
+func (l *Lock) Token() int64 {
+	return l.token
+}
+
+// Done 在释放锁或自动续期发现锁已丢失时关闭
+func (l *Lock) Done() <-chan struct{} {
+	return l.ctx.Done()
+}
+
+// Extend 将锁的过期时间重新设置为 ttl，锁已经丢失时返回 ErrLockNotHeld
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	if atomic.LoadInt32(&l.released) == 1 {
+		return ErrLockNotHeld
+	}
+	start := time.Now()
+	ok, err := lockExtendScript.Run(ctx, GetRedisCli(), []string{l.key}, l.owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		l.stop()
+		return ErrLockNotHeld
+	}
+	atomic.StoreInt64(&l.expireAt, start.Add(ttl).UnixNano())
+	return nil
+}
+
+// Release 释放锁并停止自动续期，锁已经过期或被其他持有者获取时返回 ErrLockNotHeld
+// 执行释放命令出错时锁在过期后自动释放
+func (l *Lock) Release(ctx context.Context) error {
+	if !l.stop() {
+		return ErrLockNotHeld
+	}
+	ok, err := lockReleaseScript.Run(ctx, GetRedisCli(), []string{l.key}, l.owner).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrLockNotHeld
+	}
+	GetLogger().Debug("lock released", zap.String("name", l.name), zap.Int64("token", l.token))
+	return nil
+}
+
+// releaseAfter 停止自动续期，并将锁的过期时间设置为 d，d 不大于0时立即释放
+// 用于在任务完成后继续占用一段时间，避免时钟偏差较大的其他实例重复执行
+func (l *Lock) releaseAfter(ctx context.Context, d time.Duration) error {
+	if d < time.Millisecond {
+		return l.Release(ctx)
+	}
+	if !l.stop() {
+		return ErrLockNotHeld
+	}
+	ok, err := lockExtendScript.Run(ctx, GetRedisCli(), []string{l.key}, l.owner, d.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// watchdog 每隔 TTL/3 续期一次，锁丢失或超过过期时间仍未续期成功时停止
+func (l *Lock) watchdog() {
+	ttl := l.opts.TTL.Std()
+	interval := ttl / 3
+	for sleepContext(l.ctx, interval) {
+		ctx, cancel := context.WithTimeout(l.ctx, interval)
+		err := l.Extend(ctx, ttl)
+		cancel()
+		switch {
+		case err == nil:
+			atomic.AddUint64(&l.renewals, 1)
+		case l.ctx.Err() != nil:
+			return
+		case err == ErrLockNotHeld:
+			GetLogger().Warn("lock lost", zap.String("name", l.name), zap.Int64("token", l.token))
+			return
+		default:
+			if time.Now().UnixNano() >= atomic.LoadInt64(&l.expireAt) {
+				l.stop()
+				GetLogger().Warn("lock expired before renewal", zap.String("name", l.name), zap.Error(err))
+				return
+			}
+			GetLogger().Warn("renew lock error", zap.String("name", l.name), zap.Error(err))
+		}
+	}
+}
+
+// stop 标记锁已释放并从当前进程持有的锁中移除，每个锁只会执行一次
+func (l *Lock) stop() bool {
+	if !atomic.CompareAndSwapInt32(&l.released, 0, 1) {
+		return false
+	}
+	l.cancel()
+	heldLocks.Delete(l)
+	return true
+}
+
+func (l *Lock) info() *LockInfo {
+	return &LockInfo{
+		Name:       l.name,
+		Key:        l.key,
+		Token:      l.token,
+		Owner:      l.owner,
+		AcquiredAt: l.acquiredAt,
+		ExpireAt:   time.Unix(0, atomic.LoadInt64(&l.expireAt)),
+		AutoRenew:  l.opts.AutoRenew,
+		Renewals:   atomic.LoadUint64(&l.renewals),
+	}
+}
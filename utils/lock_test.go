@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockOptionsComplete(t *testing.T) {
+	opts := (*LockOptions)(nil).complete()
+	assert.Equal(t, Duration(30*time.Second), opts.TTL)
+	assert.False(t, opts.AutoRenew)
+
+	opts = (&LockOptions{TTL: Duration(time.Second), AutoRenew: true}).complete()
+	assert.Equal(t, Duration(time.Second), opts.TTL)
+	assert.Equal(t, Duration(50*time.Millisecond), opts.InitialBackoff)
+	assert.True(t, opts.AutoRenew)
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.TODO()
+	if _, ok := PingRedis(ctx); !ok {
+		t.Skip("redis unavailable")
+	}
+	opts := &LockOptions{TTL: Duration(300 * time.Millisecond), AutoRenew: true}
+
+	l, err := TryLock(ctx, "testing:lock", opts)
+	assert.Nil(t, err)
+	_, err = TryLock(ctx, "testing:lock", opts)
+	assert.Equal(t, ErrLockNotAcquired, err)
+	assert.Len(t, HeldLocks(), 1)
+
+	// 自动续期使锁在超过 TTL 后仍然有效
+	time.Sleep(500 * time.Millisecond)
+	_, err = TryLock(ctx, "testing:lock", opts)
+	assert.Equal(t, ErrLockNotAcquired, err)
+	assert.NotZero(t, HeldLocks()[0].Renewals)
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = AcquireLock(timeout, "testing:lock", opts)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	assert.Nil(t, l.Release(ctx))
+	assert.Equal(t, ErrLockNotHeld, l.Release(ctx))
+	<-l.Done()
+	assert.Empty(t, HeldLocks())
+
+	next, err := AcquireLock(ctx, "testing:lock", nil)
+	assert.Nil(t, err)
+	assert.Greater(t, next.Token(), l.Token())
+	assert.Nil(t, next.Release(ctx))
+}
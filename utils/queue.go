@@ -0,0 +1,558 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// queueKeyReady 待处理任务ID列表，左进右出
+	queueKeyReady = "ready"
+	// queueKeyDelayed 延迟任务与等待重试的任务，分数为执行时间（毫秒）
+	queueKeyDelayed = "delayed"
+	// queueKeyInflight 正在处理的任务，分数为可见时间截止时间（毫秒），超过后重新放回待处理列表
+	queueKeyInflight = "inflight"
+	// queueKeyDead 重试次数超过上限的任务，分数为失败时间（毫秒）
+	queueKeyDead = "dead"
+	// queueKeyJobs 任务ID与任务数据
+	queueKeyJobs = "jobs"
+
+	// queueMoveLimit 每次取出任务时最多移动的到期任务数
+	queueMoveLimit = 100
+)
+
+var (
+	// ErrQueueWorkerExists 同一个队列在进程内已经存在消费者
+	ErrQueueWorkerExists = errors.New("queue worker already exists")
+	// errUnknownJobType 任务类型没有对应的处理函数，不会重试
+	errUnknownJobType = errors.New("unknown job type")
+
+	queueWorkers   = make(map[string]*QueueWorker)
+	queueWorkersMu sync.Mutex
+
+	// queueDequeueScript 先将到期的延迟任务与超过可见时间的任务放回待处理列表，再取出一个任务
+	queueDequeueScript = redis.NewScript(`
+local due = redis.call('zrangebyscore', KEYS[2], '-inf', ARGV[1], 'limit', 0, ARGV[3])
+for _, id in ipairs(due) do
+	redis.call('zrem', KEYS[2], id)
+	redis.call('lpush', KEYS[1], id)
+end
+local expired = redis.call('zrangebyscore', KEYS[3], '-inf', ARGV[1], 'limit', 0, ARGV[3])
+for _, id in ipairs(expired) do
+	redis.call('zrem', KEYS[3], id)
+	redis.call('rpush', KEYS[1], id)
+end
+local id = redis.call('rpop', KEYS[1])
+if not id then
+	return false
+end
+redis.call('zadd', KEYS[3], ARGV[2], id)
+return {id, redis.call('hget', KEYS[4], id)}`)
+)
+
+// QueueJob 队列中的任务
+type QueueJob struct {
+	ID    string `json:"id"`
+	Queue string `json:"queue"`
+	// Type 任务类型，消费者根据类型选择处理函数
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempts 已经开始处理的次数
+	Attempts int `json:"attempts"`
+	// EnqueuedAt、RunAt 入队时间与计划执行时间（毫秒时间戳）
+	EnqueuedAt int64 `json:"enqueuedAt"`
+	RunAt      int64 `json:"runAt,omitempty"`
+	// RequestID 入队时所在请求的ID，处理任务时会写入 context
+	RequestID string `json:"requestId,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+	// FailedAt 转入失败任务的时间（毫秒时间戳）
+	FailedAt int64 `json:"failedAt,omitempty"`
+}
+
+// Decode 将任务内容解析到 v 中
+func (j *QueueJob) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// QueueHandler 任务处理函数，返回错误时按退避策略重试，ctx 在超时或停止消费者时结束
+type QueueHandler func(ctx context.Context, job *QueueJob) error
+
+// Enqueue 使用 utils/json 序列化任务内容后放入队列，立即可以被处理
+func Enqueue(ctx context.Context, queue, jobType string, payload interface{}) (*QueueJob, error) {
+	return EnqueueDelay(ctx, queue, jobType, payload, 0)
+}
+
+// EnqueueDelay 将任务放入队列，在 delay 之后才能被处理
+func EnqueueDelay(ctx context.Context, queue, jobType string, payload interface{},
+	delay time.Duration) (*QueueJob, error) {
+	if queue == "" || jobType == "" {
+		return nil, errors.New("queue and type of job are required")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &QueueJob{
+		ID:         NewRequestID(),
+		Queue:      queue,
+		Type:       jobType,
+		Payload:    data,
+		EnqueuedAt: nowMillis(),
+		RequestID:  RequestIDFromContext(ctx),
+	}
+	if delay > 0 {
+		job.RunAt = toMillis(time.Now().Add(delay))
+	}
+	value, err := json.MarshalString(job)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = queueRedisCli().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, queueKey(queue, queueKeyJobs), job.ID, value)
+		if job.RunAt > 0 {
+			pipe.ZAdd(ctx, queueKey(queue, queueKeyDelayed), &redis.Z{Score: float64(job.RunAt), Member: job.ID})
+		} else {
+			pipe.LPush(ctx, queueKey(queue, queueKeyReady), job.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// QueueWorkerOptions 队列消费者配置
+type QueueWorkerOptions struct {
+	Queue string `json:"queue"`
+	// Concurrency 同时处理任务的数量
+	Concurrency int `json:"concurrency"`
+	// MaxRetries 任务的最大重试次数，处理次数超过 MaxRetries+1 后转入失败任务
+	MaxRetries int `json:"maxRetries"`
+	// InitialBackoff、MaxBackoff 重试的退避等待时长与上限
+	InitialBackoff Duration `json:"initialBackoff"`
+	MaxBackoff     Duration `json:"maxBackoff"`
+	// Timeout 单个任务的处理时长，超时后结束处理函数的 ctx，为0时不限制
+	Timeout Duration `json:"timeout"`
+	// Visibility 任务被取出后的可见时间，处理期间每隔 Visibility/3 延长一次，超过后认为消费者已经失效，任务重新放回待处理列表
+	Visibility Duration `json:"visibility"`
+	// PollInterval 队列为空时的轮询间隔
+	PollInterval Duration `json:"pollInterval"`
+}
+
+// complete 使用默认值补全未配置的项
+func (o *QueueWorkerOptions) complete() (*QueueWorkerOptions, error) {
+	if o == nil || o.Queue == "" {
+		return nil, errors.New("queue of worker is required")
+	}
+	opts := *o
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = Duration(time.Second)
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = Duration(10 * time.Minute)
+	}
+	if opts.Timeout < 0 {
+		opts.Timeout = 0
+	}
+	if opts.Visibility <= 0 {
+		opts.Visibility = Duration(5 * time.Minute)
+	}
+	if opts.Timeout > 0 && opts.Visibility <= opts.Timeout {
+		// 可见时间不能短于处理时长，否则处理中的任务会被重复取出
+		opts.Visibility = opts.Timeout * 2
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = Duration(time.Second)
+	}
+	return &opts, nil
+}
+
+// QueueWorkerStats 队列消费者的统计数据
+type QueueWorkerStats struct {
+	Queue       string `json:"queue"`
+	Concurrency int    `json:"concurrency"`
+	// Running 正在处理的任务数
+	Running int64 `json:"running"`
+	// Processed 处理的任务数，包含成功与失败
+	Processed uint64 `json:"processed"`
+	Succeeded uint64 `json:"succeeded"`
+	// Retried 处理失败后等待重试的任务数
+	Retried uint64 `json:"retried"`
+	// Dead 转入失败任务的任务数
+	Dead      uint64 `json:"dead"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// QueueWorker 队列消费者
+// 任务取出后放入处理中集合，处理成功后删除；失败时按退避策略延迟重试，重试次数超过上限后转入失败任务；
+// 消费者异常退出时，处理中的任务在超过可见时间后重新放回待处理列表
+type QueueWorker struct {
+	opts     *QueueWorkerOptions
+	handlers map[string]QueueHandler
+	backoff  Backoff
+
+	// ctx 停止取出新任务，jobCtx 结束正在处理的任务
+	ctx       context.Context
+	cancel    context.CancelFunc
+	jobCtx    context.Context
+	jobCancel context.CancelFunc
+	slots     chan struct{}
+	wg        sync.WaitGroup
+	done      chan struct{}
+
+	running   int64
+	processed uint64
+	succeeded uint64
+	retried   uint64
+	dead      uint64
+	lastError atomic.Value
+}
+
+// StartQueueWorker 创建并启动队列消费者，handlers 的键为任务类型，同一个队列在进程内只能有一个消费者
+func StartQueueWorker(opts *QueueWorkerOptions, handlers map[string]QueueHandler) (*QueueWorker, error) {
+	opts, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	queueWorkersMu.Lock()
+	defer queueWorkersMu.Unlock()
+	if _, ok := queueWorkers[opts.Queue]; ok {
+		return nil, ErrQueueWorkerExists
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	jobCtx, jobCancel := context.WithCancel(context.Background())
+	w := &QueueWorker{
+		opts:      opts,
+		handlers:  handlers,
+		backoff:   Backoff{Initial: opts.InitialBackoff.Std(), Max: opts.MaxBackoff.Std()},
+		ctx:       ctx,
+		cancel:    cancel,
+		jobCtx:    jobCtx,
+		jobCancel: jobCancel,
+		slots:     make(chan struct{}, opts.Concurrency),
+		done:      make(chan struct{}),
+	}
+	queueWorkers[opts.Queue] = w
+	Go(w.run)
+	GetLogger().Info("queue worker started", zap.String("queue", opts.Queue), zap.Int("concurrency", opts.Concurrency))
+	return w, nil
+}
+
+// QueueWorkers 所有队列消费者的统计数据，按队列名称排序
+func QueueWorkers() []*QueueWorkerStats {
+	stats := make([]*QueueWorkerStats, 0)
+	for _, w := range listQueueWorkers() {
+		stats = append(stats, w.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Queue < stats[j].Queue
+	})
+	return stats
+}
+
+// StopQueueWorkers 停止所有队列消费者，等待正在处理的任务完成或 ctx 结束
+func StopQueueWorkers(ctx context.Context) {
+	for _, w := range listQueueWorkers() {
+		w.Stop(ctx)
+	}
+}
+
+func listQueueWorkers() []*QueueWorker {
+	queueWorkersMu.Lock()
+	defer queueWorkersMu.Unlock()
+	workers := make([]*QueueWorker, 0, len(queueWorkers))
+	for _, w := range queueWorkers {
+		workers = append(workers, w)
+	}
+	return workers
+}
+
+// Stop 停止取出新任务并等待正在处理的任务完成，ctx 结束时取消正在处理的任务并直接返回
+// 被取消的任务按处理失败重试，没有响应取消的任务在超过可见时间后重新放回待处理列表
+func (w *QueueWorker) Stop(ctx context.Context) {
+	w.cancel()
+	<-w.done
+
+	finished := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		GetLogger().Warn("drain queue worker timeout, cancel running jobs", zap.String("queue", w.opts.Queue))
+	}
+	w.jobCancel()
+
+	queueWorkersMu.Lock()
+	if queueWorkers[w.opts.Queue] == w {
+		delete(queueWorkers, w.opts.Queue)
+	}
+	queueWorkersMu.Unlock()
+	GetLogger().Info("queue worker stopped", zap.String("queue", w.opts.Queue))
+}
+
+// Stats 消费者的统计数据
+func (w *QueueWorker) Stats() *QueueWorkerStats {
+	stats := &QueueWorkerStats{
+		Queue:       w.opts.Queue,
+		Concurrency: w.opts.Concurrency,
+		Running:     atomic.LoadInt64(&w.running),
+		Processed:   atomic.LoadUint64(&w.processed),
+		Succeeded:   atomic.LoadUint64(&w.succeeded),
+		Retried:     atomic.LoadUint64(&w.retried),
+		Dead:        atomic.LoadUint64(&w.dead),
+	}
+	if err, ok := w.lastError.Load().(string); ok {
+		stats.LastError = err
+	}
+	return stats
+}
+
+// run 有空闲的处理槽位时取出任务，队列为空或出错时等待 PollInterval
+func (w *QueueWorker) run() {
+	defer close(w.done)
+	for {
+		select {
+		case w.slots <- struct{}{}:
+		case <-w.ctx.Done():
+			return
+		}
+		job, err := w.dequeue()
+		if job == nil {
+			<-w.slots
+			if err != nil && w.ctx.Err() == nil {
+				w.lastError.Store(err.Error())
+				GetLogger().Warn("dequeue job error", zap.String("queue", w.opts.Queue), zap.Error(err))
+			}
+			if !sleepContext(w.ctx, w.opts.PollInterval.Std()) {
+				return
+			}
+			continue
+		}
+
+		w.wg.Add(1)
+		Go(func() {
+			defer w.wg.Done()
+			defer func() { <-w.slots }()
+			w.process(job)
+		})
+	}
+}
+
+// dequeue 取出一个任务，队列为空时返回 nil
+func (w *QueueWorker) dequeue() (*QueueJob, error) {
+	now := time.Now()
+	q := w.opts.Queue
+	res, err := queueDequeueScript.Run(w.ctx, queueRedisCli(),
+		[]string{queueKey(q, queueKeyReady), queueKey(q, queueKeyDelayed), queueKey(q, queueKeyInflight),
+			queueKey(q, queueKeyJobs)},
+		toMillis(now), toMillis(now.Add(w.opts.Visibility.Std())), queueMoveLimit).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	reply, ok := res.([]interface{})
+	if !ok || len(reply) != 2 {
+		return nil, fmt.Errorf("unexpected dequeue reply: %v", res)
+	}
+	id := fmt.Sprint(reply[0])
+	value, ok := reply[1].(string)
+	if !ok {
+		// 任务数据已经被删除
+		return nil, queueRedisCli().ZRem(w.ctx, queueKey(q, queueKeyInflight), id).Err()
+	}
+	job := new(QueueJob)
+	if err = json.UnmarshalString(value, job); err != nil {
+		return nil, fmt.Errorf("decode job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// process 处理任务，处理前先保存处理次数，避免导致进程崩溃的任务被无限重试
+func (w *QueueWorker) process(job *QueueJob) {
+	atomic.AddInt64(&w.running, 1)
+	defer atomic.AddInt64(&w.running, -1)
+	defer atomic.AddUint64(&w.processed, 1)
+
+	job.Attempts++
+	if err := w.save(job); err != nil {
+		GetLogger().Warn("save job attempts error", zap.String("queue", job.Queue), zap.String("id", job.ID),
+			zap.Error(err))
+	}
+
+	start := time.Now()
+	stopHeartbeat := w.heartbeat(job)
+	err := w.call(job)
+	stopHeartbeat()
+	if err == nil {
+		if err = w.ack(job); err != nil {
+			GetLogger().Warn("ack job error", zap.String("queue", job.Queue), zap.String("id", job.ID), zap.Error(err))
+		}
+		atomic.AddUint64(&w.succeeded, 1)
+		GetLogger().Debug("job processed",
+			zap.String("queue", job.Queue),
+			zap.String("type", job.Type),
+			zap.String("id", job.ID),
+			zap.Duration("elapsed", time.Since(start)),
+		)
+		return
+	}
+
+	job.LastError = err.Error()
+	w.lastError.Store(err.Error())
+	if job.Attempts > w.opts.MaxRetries || errors.Is(err, errUnknownJobType) {
+		job.FailedAt = nowMillis()
+		err = w.moveTo(job, queueKeyDead, job.FailedAt)
+		atomic.AddUint64(&w.dead, 1)
+		GetLogger().Warn("job failed permanently",
+			zap.String("queue", job.Queue),
+			zap.String("type", job.Type),
+			zap.String("id", job.ID),
+			zap.Int("attempts", job.Attempts),
+			zap.String("error", job.LastError),
+		)
+	} else {
+		wait := w.backoff.Duration(job.Attempts - 1)
+		job.RunAt = toMillis(time.Now().Add(wait))
+		err = w.moveTo(job, queueKeyDelayed, job.RunAt)
+		atomic.AddUint64(&w.retried, 1)
+		GetLogger().Info("job failed, retry later",
+			zap.String("queue", job.Queue),
+			zap.String("type", job.Type),
+			zap.String("id", job.ID),
+			zap.Int("attempts", job.Attempts),
+			zap.Duration("backoff", wait),
+			zap.String("error", job.LastError),
+		)
+	}
+	if err != nil {
+		GetLogger().Warn("move failed job error", zap.String("queue", job.Queue), zap.String("id", job.ID),
+			zap.Error(err))
+	}
+}
+
+// call 执行处理函数，将 panic 转换为包含调用栈的错误
+func (w *QueueWorker) call(job *QueueJob) (err error) {
+	handler, ok := w.handlers[job.Type]
+	if !ok {
+		return fmt.Errorf("%w '%s'", errUnknownJobType, job.Type)
+	}
+	ctx := w.jobCtx
+	if job.RequestID != "" {
+		ctx = WithRequestID(ctx, job.RequestID)
+	}
+	if w.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.opts.Timeout.Std())
+		defer cancel()
+	}
+	defer func() {
+		if res := recover(); res != nil {
+			err = fmt.Errorf("panic: %v\n%s", res, debug.Stack())
+		}
+	}()
+	// 只有超过处理时长才将成功返回的任务视为失败，停止消费者时已经完成的任务不会被重复处理
+	if err = handler(ctx, job); err == nil && ctx.Err() == context.DeadlineExceeded {
+		err = ctx.Err()
+	}
+	return
+}
+
+// heartbeat 任务处理期间定期延长任务的可见时间，避免处理时间较长的任务被重新放回待处理列表
+// 返回的函数停止延长并等待退出
+func (w *QueueWorker) heartbeat(job *QueueJob) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	GoNamed("queue-heartbeat:"+job.Queue, func(ctx context.Context) {
+		defer close(done)
+		interval := w.opts.Visibility.Std() / 3
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			deadline := toMillis(time.Now().Add(w.opts.Visibility.Std()))
+			writeCtx, cancel := context.WithTimeout(context.Background(), interval)
+			// XX 只更新仍在处理中集合的任务，任务已经被确认或移出时不会重新加入
+			err := queueRedisCli().ZAddXX(writeCtx, queueKey(job.Queue, queueKeyInflight),
+				&redis.Z{Score: float64(deadline), Member: job.ID}).Err()
+			cancel()
+			if err != nil {
+				GetLogger().Warn("extend job visibility error", zap.String("queue", job.Queue), zap.String("id", job.ID),
+					zap.Error(err))
+			}
+		}
+	})
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func (w *QueueWorker) save(job *QueueJob) error {
+	value, err := json.MarshalString(job)
+	if err != nil {
+		return err
+	}
+	return queueRedisCli().HSet(w.jobCtx, queueKey(job.Queue, queueKeyJobs), job.ID, value).Err()
+}
+
+// ack 处理成功，删除任务
+func (w *QueueWorker) ack(job *QueueJob) error {
+	ctx := context.Background()
+	_, err := queueRedisCli().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, queueKey(job.Queue, queueKeyInflight), job.ID)
+		pipe.HDel(ctx, queueKey(job.Queue, queueKeyJobs), job.ID)
+		return nil
+	})
+	return err
+}
+
+// moveTo 将处理失败的任务移入延迟任务或失败任务
+func (w *QueueWorker) moveTo(job *QueueJob, kind string, score int64) error {
+	value, err := json.MarshalString(job)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	_, err = queueRedisCli().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, queueKey(job.Queue, queueKeyInflight), job.ID)
+		pipe.HSet(ctx, queueKey(job.Queue, queueKeyJobs), job.ID, value)
+		pipe.ZAdd(ctx, queueKey(job.Queue, kind), &redis.Z{Score: float64(score), Member: job.ID})
+		return nil
+	})
+	return err
+}
+
+// queueKey 队列在redis中的键，队列名称使用 hash tag 保证同一个队列的键在集群的同一个槽位
+func queueKey(queue, kind string) string {
+	return "queue:{" + queue + "}:" + kind
+}
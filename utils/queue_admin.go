@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrQueueJobNotFound 失败任务不存在
+	ErrQueueJobNotFound = errors.New("queue job not found")
+
+	// queueRequeueScript 失败任务仍然存在时放回待处理列表
+	queueRequeueScript = redis.NewScript(`
+if redis.call('zrem', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('hset', KEYS[2], ARGV[1], ARGV[2])
+redis.call('lpush', KEYS[3], ARGV[1])
+return 1`)
+)
+
+// QueueDepth 队列中各状态的任务数
+type QueueDepth struct {
+	Queue    string `json:"queue"`
+	Ready    int64  `json:"ready"`
+	Delayed  int64  `json:"delayed"`
+	Inflight int64  `json:"inflight"`
+	Dead     int64  `json:"dead"`
+}
+
+// GetQueueDepth 查看队列中待处理、延迟、处理中与失败的任务数
+func GetQueueDepth(ctx context.Context, queue string) (*QueueDepth, error) {
+	var ready, delayed, inflight, dead *redis.IntCmd
+	_, err := queueRedisCli().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		ready = pipe.LLen(ctx, queueKey(queue, queueKeyReady))
+		delayed = pipe.ZCard(ctx, queueKey(queue, queueKeyDelayed))
+		inflight = pipe.ZCard(ctx, queueKey(queue, queueKeyInflight))
+		dead = pipe.ZCard(ctx, queueKey(queue, queueKeyDead))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &QueueDepth{
+		Queue:    queue,
+		Ready:    ready.Val(),
+		Delayed:  delayed.Val(),
+		Inflight: inflight.Val(),
+		Dead:     dead.Val(),
+	}, nil
+}
+
+// DeadQueueJobs 分页查看失败任务，按失败时间倒序，同时返回失败任务总数
+func DeadQueueJobs(ctx context.Context, queue string, offset, limit int64) (jobs []*QueueJob, total int64, err error) {
+	cli := queueRedisCli()
+	jobs = make([]*QueueJob, 0)
+	if total, err = cli.ZCard(ctx, queueKey(queue, queueKeyDead)).Result(); err != nil || limit <= 0 {
+		return
+	}
+	ids, err := cli.ZRevRange(ctx, queueKey(queue, queueKeyDead), offset, offset+limit-1).Result()
+	if err != nil || len(ids) == 0 {
+		return
+	}
+	values, err := cli.HMGet(ctx, queueKey(queue, queueKeyJobs), ids...).Result()
+	if err != nil {
+		return
+	}
+	for i, v := range values {
+		value, ok := v.(string)
+		if !ok {
+			// 任务数据已经被删除
+			jobs = append(jobs, &QueueJob{ID: ids[i], Queue: queue})
+			continue
+		}
+		job := new(QueueJob)
+		if err = json.UnmarshalString(value, job); err != nil {
+			return nil, 0, fmt.Errorf("decode job %s: %w", ids[i], err)
+		}
+		jobs = append(jobs, job)
+	}
+	return
+}
+
+// RequeueDeadJob 将失败任务重置处理次数后放回待处理列表，任务不存在时返回 ErrQueueJobNotFound
+func RequeueDeadJob(ctx context.Context, queue, id string) (*QueueJob, error) {
+	cli := queueRedisCli()
+	value, err := cli.HGet(ctx, queueKey(queue, queueKeyJobs), id).Result()
+	if err == redis.Nil {
+		return nil, ErrQueueJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	job := new(QueueJob)
+	if err = json.UnmarshalString(value, job); err != nil {
+		return nil, fmt.Errorf("decode job %s: %w", id, err)
+	}
+	job.Attempts, job.RunAt, job.FailedAt = 0, 0, 0
+	if value, err = json.MarshalString(job); err != nil {
+		return nil, err
+	}
+
+	ok, err := queueRequeueScript.Run(ctx, cli,
+		[]string{queueKey(queue, queueKeyDead), queueKey(queue, queueKeyJobs), queueKey(queue, queueKeyReady)},
+		id, value).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if ok == 0 {
+		return nil, ErrQueueJobNotFound
+	}
+	return job, nil
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueWorkerOptionsComplete(t *testing.T) {
+	_, err := (&QueueWorkerOptions{}).complete()
+	assert.NotNil(t, err)
+
+	opts, err := (&QueueWorkerOptions{Queue: "testing", Timeout: Duration(10 * time.Minute)}).complete()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, opts.Concurrency)
+	assert.Equal(t, Duration(time.Second), opts.PollInterval)
+	// 可见时间不能短于处理时长
+	assert.Equal(t, Duration(20*time.Minute), opts.Visibility)
+	assert.Equal(t, "queue:{testing}:ready", queueKey("testing", queueKeyReady))
+}
+
+func TestQueueWorkerCall(t *testing.T) {
+	w := &QueueWorker{
+		opts:   &QueueWorkerOptions{Timeout: Duration(10 * time.Millisecond)},
+		jobCtx: context.Background(),
+		handlers: map[string]QueueHandler{
+			"panic": func(context.Context, *QueueJob) error { panic("testing panic") },
+			"timeout": func(ctx context.Context, _ *QueueJob) error {
+				<-ctx.Done()
+				return nil
+			},
+			"request": func(ctx context.Context, job *QueueJob) error {
+				assert.Equal(t, job.RequestID, RequestIDFromContext(ctx))
+				return nil
+			},
+		},
+	}
+	assert.True(t, errors.Is(w.call(&QueueJob{Type: "unknown"}), errUnknownJobType))
+	assert.Contains(t, w.call(&QueueJob{Type: "panic"}).Error(), "panic: testing panic")
+	assert.Equal(t, context.DeadlineExceeded, w.call(&QueueJob{Type: "timeout"}))
+	assert.Nil(t, w.call(&QueueJob{Type: "request", RequestID: "testing-request"}))
+
+	// 停止消费者时已经成功完成的任务不视为失败
+	jobCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.jobCtx = jobCtx
+	w.opts.Timeout = 0
+	w.handlers["done"] = func(context.Context, *QueueJob) error { return nil }
+	assert.Nil(t, w.call(&QueueJob{Type: "done"}))
+
+	_, err := Enqueue(context.TODO(), "", "testing", nil)
+	assert.NotNil(t, err)
+}
+
+func TestQueueWorker(t *testing.T) {
+	ctx := context.TODO()
+	if _, ok := PingRedis(ctx); !ok {
+		t.Skip("redis unavailable")
+	}
+	queue := "testing:" + NewRequestID()
+	defer queueRedisCli().Del(ctx, queueKey(queue, queueKeyReady), queueKey(queue, queueKeyDelayed),
+		queueKey(queue, queueKeyInflight), queueKey(queue, queueKeyDead), queueKey(queue, queueKeyJobs))
+
+	processed := make(chan string, 10)
+	w, err := StartQueueWorker(&QueueWorkerOptions{
+		Queue:          queue,
+		MaxRetries:     1,
+		InitialBackoff: Duration(10 * time.Millisecond),
+		PollInterval:   Duration(10 * time.Millisecond),
+	}, map[string]QueueHandler{
+		"ok": func(_ context.Context, job *QueueJob) error {
+			var v string
+			assert.Nil(t, job.Decode(&v))
+			processed <- v
+			return nil
+		},
+		"fail": func(context.Context, *QueueJob) error { return errors.New("testing error") },
+	})
+	assert.Nil(t, err)
+
+	_, err = EnqueueDelay(ctx, queue, "ok", "delayed", 50*time.Millisecond)
+	assert.Nil(t, err)
+	_, err = Enqueue(ctx, queue, "ok", "now")
+	assert.Nil(t, err)
+	failed, err := Enqueue(ctx, queue, "fail", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "now", <-processed)
+	assert.Equal(t, "delayed", <-processed)
+
+	assert.Eventually(t, func() bool { return w.Stats().Dead == 1 }, time.Second, 10*time.Millisecond)
+	jobs, total, err := DeadQueueJobs(ctx, queue, 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, failed.ID, jobs[0].ID)
+	assert.Equal(t, 2, jobs[0].Attempts)
+	assert.Equal(t, "testing error", jobs[0].LastError)
+
+	w.Stop(ctx)
+	_, err = RequeueDeadJob(ctx, queue, failed.ID)
+	assert.Nil(t, err)
+	_, err = RequeueDeadJob(ctx, queue, failed.ID)
+	assert.Equal(t, ErrQueueJobNotFound, err)
+	depth, err := GetQueueDepth(ctx, queue)
+	assert.Nil(t, err)
+	assert.Equal(t, &QueueDepth{Queue: queue, Ready: 1}, depth)
+}
+
+func TestQueueWorkerHeartbeat(t *testing.T) {
+	ctx := context.TODO()
+	if _, ok := PingRedis(ctx); !ok {
+		t.Skip("redis unavailable")
+	}
+	queue := "testing:" + NewRequestID()
+	defer queueRedisCli().Del(ctx, queueKey(queue, queueKeyReady), queueKey(queue, queueKeyDelayed),
+		queueKey(queue, queueKeyInflight), queueKey(queue, queueKeyDead), queueKey(queue, queueKeyJobs))
+
+	// 处理时间超过可见时间的任务不会被重复取出
+	var calls int32
+	w, err := StartQueueWorker(&QueueWorkerOptions{
+		Queue:        queue,
+		Concurrency:  2,
+		Visibility:   Duration(150 * time.Millisecond),
+		PollInterval: Duration(10 * time.Millisecond),
+	}, map[string]QueueHandler{
+		"slow": func(context.Context, *QueueJob) error {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(500 * time.Millisecond)
+			return nil
+		},
+	})
+	assert.Nil(t, err)
+	defer w.Stop(ctx)
+
+	_, err = Enqueue(ctx, queue, "slow", nil)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return w.Stats().Succeeded == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -2,28 +2,157 @@ package utils
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"sync"
 	"time"
 
+	"github.com/frank-yf/go-web-example/utils/json"
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 )
 
+const (
+	// RedisModeStandalone 单节点模式
+	RedisModeStandalone = "standalone"
+	// RedisModeSentinel 哨兵模式，通过哨兵自动切换主节点
+	RedisModeSentinel = "sentinel"
+	// RedisModeCluster 集群模式
+	RedisModeCluster = "cluster"
+)
+
 var (
-	redisClient *redis.Client
+	redisOpts   *RedisOptions
+	redisClient redis.UniversalClient
 	redisOnce   sync.Once
 )
 
-func GetRedisCli() *redis.Client {
+// RedisOptions redis连接配置
+type RedisOptions struct {
+	// Mode 部署模式，可选 standalone、sentinel、cluster
+	Mode string `json:"mode"`
+
+	//连接信息
+	Network string `json:"network"` //网络类型，tcp or unix，只在单节点模式生效
+	// Addrs 单节点模式只使用第一个地址（unix 网络类型时为 socket 文件路径）；哨兵模式为哨兵节点地址；集群模式为种子节点地址
+	Addrs []string `json:"addrs"`
+	// MasterName 哨兵模式监控的主节点名称
+	MasterName string `json:"masterName"`
+	// SentinelPassword 哨兵节点的密码
+	SentinelPassword string `json:"sentinelPassword"`
+	Username         string `json:"username"` // ACL用户名，redis 6.0 以上版本可用
+	Password         string `json:"password"` //密码
+	DB               int    `json:"db"`       // redis数据库index，集群模式不可用
+
+	// TLS 加密连接配置，为空时不使用加密连接
+	TLS *RedisTLSOptions `json:"tls"`
+
+	//连接池容量及闲置连接数量
+	PoolSize     int `json:"poolSize"`     // 连接池最大socket连接数，默认为4倍CPU数， 4 * runtime.NumCPU
+	MinIdleConns int `json:"minIdleConns"` //在启动阶段创建指定数量的Idle连接，并长期维持idle状态的连接数不少于指定数量；
+
+	//超时
+	DialTimeout  Duration `json:"dialTimeout"`  //连接建立超时时间，默认5秒。
+	ReadTimeout  Duration `json:"readTimeout"`  //读超时，默认3秒， -1表示取消读超时
+	WriteTimeout Duration `json:"writeTimeout"` //写超时，默认等于读超时
+	PoolTimeout  Duration `json:"poolTimeout"`  //当所有连接都处在繁忙状态时，客户端等待可用连接的最大等待时长，默认为读超时+1秒。
+
+	//闲置连接检查包括IdleTimeout，MaxConnAge
+	IdleCheckFrequency Duration `json:"idleCheckFrequency"` //闲置连接检查的周期，默认为1分钟，-1表示不做周期性检查，只在客户端获取连接时对闲置连接进行处理。
+	IdleTimeout        Duration `json:"idleTimeout"`        //闲置超时，默认5分钟，-1表示取消闲置超时检查
+	MaxConnAge         Duration `json:"maxConnAge"`         //连接存活时长，从创建开始计时，超过指定时长则关闭连接，默认为0，即不关闭存活时长较长的连接
+
+	//命令执行失败时的重试策略
+	MaxRetries      int      `json:"maxRetries"`      // 命令执行失败时，最多重试多少次，默认为0即不重试
+	MinRetryBackoff Duration `json:"minRetryBackoff"` // 每次计算重试间隔时间的下限，默认8毫秒，-1表示取消间隔
+	MaxRetryBackoff Duration `json:"maxRetryBackoff"` // 每次计算重试间隔时间的上限，默认512毫秒，-1表示取消间隔
+
+	//集群模式的路由策略
+	MaxRedirects   int  `json:"maxRedirects"`   // 遇到 MOVED/ASK 重定向时的最大重试次数，默认3次
+	ReadOnly       bool `json:"readOnly"`       // 是否允许在从节点执行只读命令
+	RouteByLatency bool `json:"routeByLatency"` // 只读命令路由到延迟最低的节点，开启后 ReadOnly 自动生效
+	RouteRandomly  bool `json:"routeRandomly"`  // 只读命令随机路由到任意节点，开启后 ReadOnly 自动生效
+
+	// SlowThreshold 慢命令的耗时阈值，超过阈值的命令会记录日志，为0时不记录
+	SlowThreshold Duration `json:"slowThreshold"`
+	// Breaker 熔断器配置，未配置时使用默认配置
+	Breaker *BreakerOptions `json:"breaker"`
+}
+
+// RedisTLSOptions redis加密连接配置
+type RedisTLSOptions struct {
+	// ServerName 校验服务端证书使用的域名，为空时使用连接地址
+	ServerName string `json:"serverName"`
+	// InsecureSkipVerify 跳过服务端证书校验，只应该在测试环境中使用
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+	// CAFile 校验服务端证书的CA证书文件，为空时使用系统证书
+	CAFile string `json:"caFile"`
+	// CertFile、KeyFile 双向认证时客户端的证书与私钥文件
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// DefaultRedisOptions redis默认的连接配置
+func DefaultRedisOptions() *RedisOptions {
+	return &RedisOptions{
+		Mode:    RedisModeStandalone,
+		Network: "tcp",
+		Addrs:   []string{"localhost:6379"},
+		DB:      6,
+
+		PoolSize:     20,
+		MinIdleConns: 2,
+
+		DialTimeout:  Duration(5 * time.Second),
+		ReadTimeout:  Duration(3 * time.Second),
+		WriteTimeout: Duration(3 * time.Second),
+		PoolTimeout:  Duration(4 * time.Second),
+
+		IdleCheckFrequency: Duration(60 * time.Second),
+		IdleTimeout:        Duration(5 * time.Minute),
+		MaxConnAge:         0,
+
+		MaxRetries:      0,
+		MinRetryBackoff: Duration(8 * time.Millisecond),
+		MaxRetryBackoff: Duration(512 * time.Millisecond),
+
+		SlowThreshold: Duration(100 * time.Millisecond),
+		Breaker:       DefaultBreakerOptions(),
+	}
+}
+
+// UnmarshalJSON 在默认配置的基础上反序列化，未声明的项使用默认值
+func (o *RedisOptions) UnmarshalJSON(data []byte) error {
+	type plain RedisOptions
+	opts := (*plain)(DefaultRedisOptions())
+	if err := json.Unmarshal(data, opts); err != nil {
+		return err
+	}
+	*o = RedisOptions(*opts)
+	return nil
+}
+
+// InitRedis 根据配置初始化redis连接，需要在首次调用 GetRedisCli 之前执行
+func InitRedis(opts *RedisOptions) {
+	redisOpts = opts
+}
+
+func GetRedisCli() redis.UniversalClient {
 	redisOnce.Do(initRedisClient)
 	return redisClient
 }
 
+// CloseRedisCli 依次关闭订阅连接池、命名的redis客户端与默认的redis客户端
+// 消息流消费者需要在此之前通过 StopStreamConsumers 停止
 func CloseRedisCli() {
 	if err := GetRedisSubPool().Close(); err != nil {
 		GetLogger().Error("close redis subscription pool error", zap.Error(err))
 	}
 
+	closeRedisNamed()
+
 	err := GetRedisCli().Close()
 	if err != nil {
 		GetLogger().Error("close redis error", zap.Error(err))
@@ -33,34 +162,149 @@ func CloseRedisCli() {
 }
 
 func initRedisClient() {
-	redisClient = redis.NewClient(&redis.Options{
-		//连接信息
-		Network:  "tcp",            //网络类型，tcp or unix，默认tcp
-		Addr:     "localhost:6379", //主机名+冒号+端口，默认localhost:6379
-		Password: "",               //密码
-		DB:       6,                // redis数据库index
-
-		//连接池容量及闲置连接数量
-		PoolSize:     20, // 连接池最大socket连接数，默认为4倍CPU数， 4 * runtime.NumCPU
-		MinIdleConns: 2,  //在启动阶段创建指定数量的Idle连接，并长期维持idle状态的连接数不少于指定数量；
-
-		//超时
-		DialTimeout:  5 * time.Second, //连接建立超时时间，默认5秒。
-		ReadTimeout:  3 * time.Second, //读超时，默认3秒， -1表示取消读超时
-		WriteTimeout: 3 * time.Second, //写超时，默认等于读超时
-		PoolTimeout:  4 * time.Second, //当所有连接都处在繁忙状态时，客户端等待可用连接的最大等待时长，默认为读超时+1秒。
-
-		//闲置连接检查包括IdleTimeout，MaxConnAge
-		IdleCheckFrequency: 60 * time.Second, //闲置连接检查的周期，默认为1分钟，-1表示不做周期性检查，只在客户端获取连接时对闲置连接进行处理。
-		IdleTimeout:        5 * time.Minute,  //闲置超时，默认5分钟，-1表示取消闲置超时检查
-		MaxConnAge:         0 * time.Second,  //连接存活时长，从创建开始计时，超过指定时长则关闭连接，默认为0，即不关闭存活时长较长的连接
-
-		//命令执行失败时的重试策略
-		MaxRetries:      0,                      // 命令执行失败时，最多重试多少次，默认为0即不重试
-		MinRetryBackoff: 8 * time.Millisecond,   // 每次计算重试间隔时间的下限，默认8毫秒，-1表示取消间隔
-		MaxRetryBackoff: 512 * time.Millisecond, // 每次计算重试间隔时间的上限，默认512毫秒，-1表示取消间隔
-	})
-	GetLogger().Info("redis pool ready...")
+	opts := redisOpts
+	if opts == nil {
+		opts = DefaultRedisOptions()
+	}
+	client, err := newRedisClient(opts)
+	if err != nil {
+		panic(fmt.Sprintf("cannot create redis client : %s", err.Error()))
+	}
+	instrumentRedisClient(RedisNameDefault, client, opts)
+	redisClient = client
+	GetLogger().Info("redis pool ready...",
+		zap.String("mode", opts.Mode),
+		zap.Strings("addrs", opts.Addrs),
+		zap.Bool("tls", opts.TLS != nil),
+	)
+}
+
+// newRedisClient 根据部署模式创建redis客户端
+func newRedisClient(opts *RedisOptions) (redis.UniversalClient, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, fmt.Errorf("redis addrs must not be empty")
+	}
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Mode {
+	case RedisModeStandalone, "":
+		return redis.NewClient(&redis.Options{
+			Network:            opts.Network,
+			Addr:               opts.Addrs[0],
+			Username:           opts.Username,
+			Password:           opts.Password,
+			DB:                 opts.DB,
+			TLSConfig:          tlsConfig,
+			PoolSize:           opts.PoolSize,
+			MinIdleConns:       opts.MinIdleConns,
+			DialTimeout:        opts.DialTimeout.Std(),
+			ReadTimeout:        opts.ReadTimeout.Std(),
+			WriteTimeout:       opts.WriteTimeout.Std(),
+			PoolTimeout:        opts.PoolTimeout.Std(),
+			IdleCheckFrequency: opts.IdleCheckFrequency.Std(),
+			IdleTimeout:        opts.IdleTimeout.Std(),
+			MaxConnAge:         opts.MaxConnAge.Std(),
+			MaxRetries:         opts.MaxRetries,
+			MinRetryBackoff:    opts.MinRetryBackoff.Std(),
+			MaxRetryBackoff:    opts.MaxRetryBackoff.Std(),
+		}), nil
+	case RedisModeSentinel:
+		if opts.MasterName == "" {
+			return nil, fmt.Errorf("redis masterName is required in sentinel mode")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:         opts.MasterName,
+			SentinelAddrs:      opts.Addrs,
+			SentinelPassword:   opts.SentinelPassword,
+			Username:           opts.Username,
+			Password:           opts.Password,
+			DB:                 opts.DB,
+			TLSConfig:          tlsConfig,
+			PoolSize:           opts.PoolSize,
+			MinIdleConns:       opts.MinIdleConns,
+			DialTimeout:        opts.DialTimeout.Std(),
+			ReadTimeout:        opts.ReadTimeout.Std(),
+			WriteTimeout:       opts.WriteTimeout.Std(),
+			PoolTimeout:        opts.PoolTimeout.Std(),
+			IdleCheckFrequency: opts.IdleCheckFrequency.Std(),
+			IdleTimeout:        opts.IdleTimeout.Std(),
+			MaxConnAge:         opts.MaxConnAge.Std(),
+			MaxRetries:         opts.MaxRetries,
+			MinRetryBackoff:    opts.MinRetryBackoff.Std(),
+			MaxRetryBackoff:    opts.MaxRetryBackoff.Std(),
+		}), nil
+	case RedisModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:              opts.Addrs,
+			MaxRedirects:       opts.MaxRedirects,
+			ReadOnly:           opts.ReadOnly,
+			RouteByLatency:     opts.RouteByLatency,
+			RouteRandomly:      opts.RouteRandomly,
+			Username:           opts.Username,
+			Password:           opts.Password,
+			TLSConfig:          tlsConfig,
+			PoolSize:           opts.PoolSize,
+			MinIdleConns:       opts.MinIdleConns,
+			DialTimeout:        opts.DialTimeout.Std(),
+			ReadTimeout:        opts.ReadTimeout.Std(),
+			WriteTimeout:       opts.WriteTimeout.Std(),
+			PoolTimeout:        opts.PoolTimeout.Std(),
+			IdleCheckFrequency: opts.IdleCheckFrequency.Std(),
+			IdleTimeout:        opts.IdleTimeout.Std(),
+			MaxConnAge:         opts.MaxConnAge.Std(),
+			MaxRetries:         opts.MaxRetries,
+			MinRetryBackoff:    opts.MinRetryBackoff.Std(),
+			MaxRetryBackoff:    opts.MaxRetryBackoff.Std(),
+		}), nil
+	default:
+		return nil, fmt.Errorf("redis mode must in [%s|%s|%s]", RedisModeStandalone, RedisModeSentinel, RedisModeCluster)
+	}
+}
+
+// config 生成加密连接配置，未配置时返回 nil
+func (o *RedisTLSOptions) config() (*tls.Config, error) {
+	if o == nil {
+		return nil, nil
+	}
+	conf := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if o.CAFile != "" {
+		ca, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("cannot parse redis ca file : %s", o.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// forEachRedisNode 在每个存储数据的节点上执行 fn，集群模式下并发遍历所有主节点
+// 用于 SCAN 等只作用于单个节点的命令
+func forEachRedisNode(ctx context.Context, cli redis.UniversalClient,
+	fn func(ctx context.Context, client redis.UniversalClient) error) error {
+	if cluster, ok := cli.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return fn(ctx, client)
+		})
+	}
+	return fn(ctx, cli)
 }
 
 func PingRedis(ctx context.Context) (string, bool) {
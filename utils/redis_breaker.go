@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// redisBlockingCommands 阻塞命令的耗时取决于等待时长，不参与熔断器的耗时判断
+	redisBlockingCommands = NewSet("blpop", "brpop", "brpoplpush", "blmove",
+		"bzpopmin", "bzpopmax", "xread", "xreadgroup", "wait")
+
+	redisBreakers   = make(map[string]*CircuitBreaker)
+	redisBreakersMu sync.RWMutex
+)
+
+// redisBreakerStartKey 熔断器放行的命令开始执行时间在 context 中的键
+// 被熔断器拒绝的命令不会携带该键，AfterProcess 据此跳过记录
+type redisBreakerStartKey struct{}
+
+// redisBreakerHook 使用熔断器保护redis命令，熔断器打开时命令直接返回 ErrCircuitOpen
+type redisBreakerHook struct {
+	breaker *CircuitBreaker
+}
+
+var _ redis.Hook = (*redisBreakerHook)(nil)
+
+// guardRedisClient 为redis客户端添加熔断器，需要在统计hook之后添加，使被拒绝的命令同样计入统计
+func guardRedisClient(name string, client redis.UniversalClient, opts *RedisOptions) {
+	breaker := NewCircuitBreaker("redis."+name, opts.Breaker)
+	client.AddHook(&redisBreakerHook{breaker: breaker})
+
+	redisBreakersMu.Lock()
+	redisBreakers[name] = breaker
+	redisBreakersMu.Unlock()
+}
+
+// GetRedisBreakerStats 获取指定redis客户端的熔断器状态
+// 命名客户端没有单独配置时与默认客户端共用熔断器
+func GetRedisBreakerStats(name string) *BreakerStats {
+	breaker := redisBreaker(name)
+	if breaker == nil {
+		return nil
+	}
+	return breaker.Stats()
+}
+
+// redisBreakerOpen 指定redis客户端的熔断器是否处于打开状态
+func redisBreakerOpen(name string) bool {
+	breaker := redisBreaker(name)
+	return breaker != nil && breaker.State() == BreakerOpen
+}
+
+func redisBreaker(name string) *CircuitBreaker {
+	if !HasRedisCliNamed(name) {
+		return nil
+	}
+	GetRedisCliNamed(name)
+
+	redisBreakersMu.RLock()
+	defer redisBreakersMu.RUnlock()
+	breaker, ok := redisBreakers[name]
+	if !ok {
+		breaker = redisBreakers[RedisNameDefault]
+	}
+	return breaker
+}
+
+func (h *redisBreakerHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	if err := h.breaker.Allow(); err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, redisBreakerStartKey{}, time.Now()), nil
+}
+
+func (h *redisBreakerHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.record(ctx, []redis.Cmder{cmd})
+	return nil
+}
+
+func (h *redisBreakerHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	if err := h.breaker.Allow(); err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, redisBreakerStartKey{}, time.Now()), nil
+}
+
+func (h *redisBreakerHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	h.record(ctx, cmds)
+	return nil
+}
+
+// record 记录命令的执行结果，任意命令失败即视为失败；包含阻塞命令时不计算耗时
+func (h *redisBreakerHook) record(ctx context.Context, cmds []redis.Cmder) {
+	start, ok := ctx.Value(redisBreakerStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(start)
+
+	failed := false
+	for _, cmd := range cmds {
+		if redisBlockingCommands.Has(cmd.Name()) {
+			elapsed = 0
+		}
+		failed = failed || redisBreakerFailure(cmd.Err())
+	}
+	h.breaker.Record(elapsed, failed)
+}
+
+// redisBreakerFailure 错误是否说明redis不可用
+// 键不存在、服务端返回的命令错误以及调用方主动取消不计为失败
+func redisBreakerFailure(err error) bool {
+	if err == nil || err == redis.Nil {
+		return false
+	}
+	switch classifyRedisError(err) {
+	case redisErrServer, redisErrCanceled:
+		return false
+	}
+	return true
+}
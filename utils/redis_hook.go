@@ -0,0 +1,321 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// redisPipelineName 管道命令在统计数据中的名称
+	redisPipelineName = "pipeline"
+
+	redisErrTimeout     = "timeout"
+	redisErrPoolTimeout = "pool_timeout"
+	redisErrConnection  = "connection"
+	redisErrServer      = "server"
+	redisErrClosed      = "closed"
+	redisErrCanceled    = "canceled"
+	redisErrCircuitOpen = "circuit_open"
+	redisErrOther       = "other"
+)
+
+var (
+	// redisLatencyBuckets 命令耗时直方图各个桶的上限，超过最后一个上限的计入 +Inf
+	redisLatencyBuckets = []time.Duration{
+		time.Millisecond,
+		5 * time.Millisecond,
+		10 * time.Millisecond,
+		50 * time.Millisecond,
+		100 * time.Millisecond,
+		500 * time.Millisecond,
+		time.Second,
+	}
+
+	// redisSensitiveCommands 参数中包含凭证等敏感信息的命令，记录日志时隐藏全部参数
+	redisSensitiveCommands = NewSet("auth", "hello", "migrate", "acl", "config")
+
+	redisHooks   = make(map[string]*redisHook)
+	redisHooksMu sync.RWMutex
+)
+
+// redisHookStartKey 命令开始执行时间在 context 中的键
+type redisHookStartKey struct{}
+
+// redisHook 记录redis命令的耗时、错误以及慢命令日志
+type redisHook struct {
+	name          string
+	slowThreshold time.Duration
+
+	mu       sync.Mutex
+	commands map[string]*redisCommandStat
+	errors   map[string]uint64
+	slow     uint64
+}
+
+var _ redis.Hook = (*redisHook)(nil)
+
+type redisCommandStat struct {
+	count   uint64
+	errors  uint64
+	total   time.Duration
+	max     time.Duration
+	buckets []uint64
+}
+
+// RedisCommandStats redis命令统计数据
+type RedisCommandStats struct {
+	// Commands 每个命令的统计数据，管道命令统一记为 pipeline
+	Commands map[string]*RedisCommandStat `json:"commands"`
+	// Errors 按错误类型统计的错误数
+	Errors map[string]uint64 `json:"errors"`
+	// Slow 慢命令数量
+	Slow uint64 `json:"slow"`
+	// SlowThreshold 慢命令的耗时阈值
+	SlowThreshold Duration `json:"slowThreshold"`
+}
+
+// RedisCommandStat 单个命令的统计数据
+type RedisCommandStat struct {
+	Count  uint64   `json:"count"`
+	Errors uint64   `json:"errors"`
+	Avg    Duration `json:"avg"`
+	Max    Duration `json:"max"`
+	// Histogram 耗时分布，每个桶只统计落在上一个桶上限与本桶上限之间的数量
+	Histogram []RedisLatencyBucket `json:"histogram"`
+}
+
+// RedisLatencyBucket 耗时直方图的桶
+type RedisLatencyBucket struct {
+	Le    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+// instrumentRedisClient 为redis客户端添加统计、慢命令日志与熔断器
+func instrumentRedisClient(name string, client redis.UniversalClient, opts *RedisOptions) {
+	hook := &redisHook{
+		name:          name,
+		slowThreshold: opts.SlowThreshold.Std(),
+		commands:      make(map[string]*redisCommandStat),
+		errors:        make(map[string]uint64),
+	}
+	client.AddHook(hook)
+
+	redisHooksMu.Lock()
+	redisHooks[name] = hook
+	redisHooksMu.Unlock()
+
+	guardRedisClient(name, client, opts)
+}
+
+// GetRedisCommandStats 获取指定redis客户端的命令统计数据
+// 命名客户端没有单独配置时与默认客户端共用统计数据
+func GetRedisCommandStats(name string) *RedisCommandStats {
+	if !HasRedisCliNamed(name) {
+		return nil
+	}
+	GetRedisCliNamed(name)
+
+	redisHooksMu.RLock()
+	hook, ok := redisHooks[name]
+	if !ok {
+		hook = redisHooks[RedisNameDefault]
+	}
+	redisHooksMu.RUnlock()
+	return hook.stats()
+}
+
+func (h *redisHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisHookStartKey{}, time.Now()), nil
+}
+
+func (h *redisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	elapsed := redisElapsed(ctx)
+	h.observe(ctx, cmd.Name(), elapsed, []redis.Cmder{cmd})
+
+	if elapsed >= h.slowThreshold && h.slowThreshold > 0 {
+		GetLogger().Warn("slow redis command",
+			zap.String("client", h.name),
+			zap.String("command", redactRedisCmd(cmd)),
+			zap.Duration("elapsed", elapsed),
+			requestIDField(ctx),
+		)
+	}
+	return nil
+}
+
+func (h *redisHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisHookStartKey{}, time.Now()), nil
+}
+
+func (h *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	elapsed := redisElapsed(ctx)
+	h.observe(ctx, redisPipelineName, elapsed, cmds)
+
+	if elapsed >= h.slowThreshold && h.slowThreshold > 0 {
+		commands := make([]string, 0, len(cmds))
+		for _, cmd := range cmds {
+			commands = append(commands, redactRedisCmd(cmd))
+		}
+		GetLogger().Warn("slow redis pipeline",
+			zap.String("client", h.name),
+			zap.Strings("commands", commands),
+			zap.Duration("elapsed", elapsed),
+			requestIDField(ctx),
+		)
+	}
+	return nil
+}
+
+// observe 记录命令耗时与错误，管道中的每个命令分别统计错误
+func (h *redisHook) observe(ctx context.Context, name string, elapsed time.Duration, cmds []redis.Cmder) {
+	type cmdError struct {
+		cmd     redis.Cmder
+		errType string
+	}
+	var errs []cmdError
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			errs = append(errs, cmdError{cmd: cmd, errType: classifyRedisError(err)})
+		}
+	}
+
+	h.mu.Lock()
+	stat, ok := h.commands[name]
+	if !ok {
+		stat = &redisCommandStat{buckets: make([]uint64, len(redisLatencyBuckets)+1)}
+		h.commands[name] = stat
+	}
+	stat.count++
+	stat.total += elapsed
+	if elapsed > stat.max {
+		stat.max = elapsed
+	}
+	i := 0
+	for i < len(redisLatencyBuckets) && elapsed > redisLatencyBuckets[i] {
+		i++
+	}
+	stat.buckets[i]++
+	if len(errs) > 0 {
+		stat.errors++
+	}
+	for _, e := range errs {
+		h.errors[e.errType]++
+	}
+	if elapsed >= h.slowThreshold && h.slowThreshold > 0 {
+		h.slow++
+	}
+	h.mu.Unlock()
+
+	for _, e := range errs {
+		if e.errType == redisErrCircuitOpen {
+			// 熔断器打开期间每个命令都会被拒绝，状态变化时已经记录日志
+			continue
+		}
+		GetLogger().Warn("redis command error",
+			zap.String("client", h.name),
+			zap.String("command", redactRedisCmd(e.cmd)),
+			zap.String("errorType", e.errType),
+			zap.Error(e.cmd.Err()),
+			requestIDField(ctx),
+		)
+	}
+}
+
+func (h *redisHook) stats() *RedisCommandStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := &RedisCommandStats{
+		Commands:      make(map[string]*RedisCommandStat, len(h.commands)),
+		Errors:        make(map[string]uint64, len(h.errors)),
+		Slow:          h.slow,
+		SlowThreshold: Duration(h.slowThreshold),
+	}
+	for name, stat := range h.commands {
+		histogram := make([]RedisLatencyBucket, 0, len(stat.buckets))
+		for i, count := range stat.buckets {
+			le := "+Inf"
+			if i < len(redisLatencyBuckets) {
+				le = redisLatencyBuckets[i].String()
+			}
+			histogram = append(histogram, RedisLatencyBucket{Le: le, Count: count})
+		}
+		stats.Commands[name] = &RedisCommandStat{
+			Count:     stat.count,
+			Errors:    stat.errors,
+			Avg:       Duration(stat.total / time.Duration(stat.count)),
+			Max:       Duration(stat.max),
+			Histogram: histogram,
+		}
+	}
+	for errType, n := range h.errors {
+		stats.Errors[errType] = n
+	}
+	return stats
+}
+
+func redisElapsed(ctx context.Context) time.Duration {
+	if start, ok := ctx.Value(redisHookStartKey{}).(time.Time); ok {
+		return time.Since(start)
+	}
+	return 0
+}
+
+// redactRedisCmd 生成用于日志的命令描述，只保留命令名称与首个参数（通常为键），其余参数使用 ? 代替
+func redactRedisCmd(cmd redis.Cmder) string {
+	args := cmd.Args()
+	name := cmd.Name()
+	if redisSensitiveCommands.Has(name) {
+		return name + " [redacted]"
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	for i := 1; i < len(args); i++ {
+		if i == 1 {
+			b.WriteByte(' ')
+			b.WriteString(fmt.Sprint(args[i]))
+		} else {
+			b.WriteString(" ?")
+		}
+	}
+	return b.String()
+}
+
+// classifyRedisError 按错误类型归类，用于错误统计
+func classifyRedisError(err error) string {
+	var netErr net.Error
+	var redisErr redis.Error
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return redisErrCircuitOpen
+	case errors.Is(err, context.Canceled):
+		return redisErrCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return redisErrTimeout
+	case errors.Is(err, redis.ErrClosed):
+		return redisErrClosed
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return redisErrConnection
+	case err.Error() == "redis: connection pool timeout":
+		return redisErrPoolTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return redisErrTimeout
+		}
+		return redisErrConnection
+	case errors.As(err, &redisErr):
+		return redisErrServer
+	default:
+		return redisErrOther
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactRedisCmd(t *testing.T) {
+	ctx := context.TODO()
+	assert.Equal(t, "set user:1 ? ? ?", redactRedisCmd(redis.NewStatusCmd(ctx, "set", "user:1", "secret", "px", 1000)))
+	assert.Equal(t, "auth [redacted]", redactRedisCmd(redis.NewStatusCmd(ctx, "auth", "user", "password")))
+	assert.Equal(t, "ping", redactRedisCmd(redis.NewStatusCmd(ctx, "ping")))
+}
+
+func TestRedisHookObserve(t *testing.T) {
+	ctx := WithRequestID(context.TODO(), "testing-request")
+	hook := &redisHook{
+		name:          "testing",
+		slowThreshold: 50 * time.Millisecond,
+		commands:      make(map[string]*redisCommandStat),
+		errors:        make(map[string]uint64),
+	}
+
+	get := redis.NewStringCmd(ctx, "get", "k")
+	get.SetErr(redis.Nil)
+	hook.observe(ctx, get.Name(), 2*time.Millisecond, []redis.Cmder{get})
+
+	set := redis.NewStatusCmd(ctx, "set", "k", "v")
+	set.SetErr(context.DeadlineExceeded)
+	del := redis.NewIntCmd(ctx, "del", "k")
+	del.SetErr(errors.New("unknown"))
+	hook.observe(ctx, redisPipelineName, time.Second, []redis.Cmder{set, del})
+
+	stats := hook.stats()
+	assert.Equal(t, uint64(1), stats.Commands["get"].Count)
+	assert.Equal(t, uint64(0), stats.Commands["get"].Errors)
+	assert.Equal(t, uint64(1), stats.Commands["get"].Histogram[1].Count)
+	assert.Equal(t, uint64(1), stats.Commands[redisPipelineName].Errors)
+	assert.Equal(t, uint64(1), stats.Errors[redisErrTimeout])
+	assert.Equal(t, uint64(1), stats.Errors[redisErrOther])
+	assert.Equal(t, uint64(1), stats.Slow)
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// RedisNameDefault 默认redis客户端的名称
+	RedisNameDefault = "default"
+	// RedisNameCache 缓存使用的redis客户端名称
+	RedisNameCache = "cache"
+	// RedisNamePubSub 发布订阅使用的redis客户端名称
+	RedisNamePubSub = "pubsub"
+	// RedisNameStream 消息流使用的redis客户端名称
+	RedisNameStream = "stream"
+	// RedisNameQueue 任务队列使用的redis客户端名称
+	RedisNameQueue = "queue"
+)
+
+var (
+	namedRedisOpts    map[string]*RedisOptions
+	namedRedisClients = make(map[string]redis.UniversalClient)
+	// namedRedisOrder 命名客户端的创建顺序，关闭时按相反的顺序执行
+	namedRedisOrder []string
+	namedRedisMu    sync.Mutex
+)
+
+// InitRedisNamed 根据配置初始化命名的redis客户端，需要在首次调用 GetRedisCliNamed 之前执行
+func InitRedisNamed(opts map[string]*RedisOptions) {
+	namedRedisOpts = opts
+}
+
+// GetRedisCliNamed 获取指定名称的redis客户端，客户端在首次获取时创建
+// 名称没有单独配置时使用默认的redis客户端
+func GetRedisCliNamed(name string) redis.UniversalClient {
+	if !HasRedisCliNamed(name) || name == RedisNameDefault {
+		return GetRedisCli()
+	}
+
+	namedRedisMu.Lock()
+	defer namedRedisMu.Unlock()
+
+	if client, ok := namedRedisClients[name]; ok {
+		return client
+	}
+	opts := namedRedisOpts[name]
+	client, err := newRedisClient(opts)
+	if err != nil {
+		panic(fmt.Sprintf("cannot create redis client '%s' : %s", name, err.Error()))
+	}
+	instrumentRedisClient(name, client, opts)
+	namedRedisClients[name] = client
+	namedRedisOrder = append(namedRedisOrder, name)
+	GetLogger().Info("named redis pool ready...",
+		zap.String("name", name),
+		zap.String("mode", opts.Mode),
+		zap.Strings("addrs", opts.Addrs),
+	)
+	return client
+}
+
+// HasRedisCliNamed 是否存在指定名称的redis客户端，默认客户端总是存在
+func HasRedisCliNamed(name string) bool {
+	if name == RedisNameDefault {
+		return true
+	}
+	_, ok := namedRedisOpts[name]
+	return ok
+}
+
+// RedisCliNames 所有redis客户端的名称，默认客户端排在首位
+func RedisCliNames() []string {
+	names := make([]string, 0, len(namedRedisOpts)+1)
+	for name := range namedRedisOpts {
+		if name != RedisNameDefault {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{RedisNameDefault}, names...)
+}
+
+// PingRedisNamed 检查指定名称的redis客户端连接
+func PingRedisNamed(ctx context.Context, name string) (string, bool) {
+	sc := GetRedisCliNamed(name).Ping(ctx)
+	return sc.String(), sc.Val() == "PONG"
+}
+
+// RedisClientHealth redis客户端的健康状态
+type RedisClientHealth struct {
+	// Ping ping 命令的执行结果
+	Ping string `json:"ping"`
+	// Breaker 熔断器状态，熔断器打开时 ping 直接失败
+	Breaker string `json:"breaker"`
+	// Degraded 非必需的依赖在启动检查失败时的错误，应用以降级模式运行
+	Degraded string `json:"degraded,omitempty"`
+	// Leaders 使用该客户端的 leader 选举状态，只有默认客户端有值
+	Leaders []*LeaderInfo `json:"leaders,omitempty"`
+}
+
+// RedisHealth 检查所有redis客户端的连接，返回每个客户端的 ping 结果、熔断器状态与启动检查的降级状态
+func RedisHealth(ctx context.Context) (health map[string]*RedisClientHealth, ok bool) {
+	ok = true
+	health = make(map[string]*RedisClientHealth)
+	for _, name := range RedisCliNames() {
+		res, pong := PingRedisNamed(ctx, name)
+		health[name] = &RedisClientHealth{
+			Ping:    res,
+			Breaker: GetRedisBreakerStats(name).State,
+		}
+		if err := dependencyDegraded(redisDependencyName(name)); err != nil {
+			health[name].Degraded = err.Error()
+		}
+		ok = ok && pong
+	}
+	if leaders := LeaderElections(ctx); len(leaders) > 0 {
+		health[RedisNameDefault].Leaders = leaders
+	}
+	return
+}
+
+// closeRedisNamed 按创建顺序的相反顺序关闭命名的redis客户端
+func closeRedisNamed() {
+	namedRedisMu.Lock()
+	defer namedRedisMu.Unlock()
+
+	for i := len(namedRedisOrder) - 1; i >= 0; i-- {
+		name := namedRedisOrder[i]
+		if err := namedRedisClients[name].Close(); err != nil {
+			GetLogger().Error("close named redis error", zap.String("name", name), zap.Error(err))
+		} else {
+			GetLogger().Info("named redis closed", zap.String("name", name))
+		}
+		delete(namedRedisClients, name)
+	}
+	namedRedisOrder = nil
+}
+
+// cacheRedisCli 缓存使用的redis客户端
+func cacheRedisCli() redis.UniversalClient {
+	return GetRedisCliNamed(RedisNameCache)
+}
+
+// pubSubRedisCli 发布订阅使用的redis客户端
+func pubSubRedisCli() redis.UniversalClient {
+	return GetRedisCliNamed(RedisNamePubSub)
+}
+
+// streamRedisCli 消息流使用的redis客户端
+func streamRedisCli() redis.UniversalClient {
+	return GetRedisCliNamed(RedisNameStream)
+}
+
+// queueRedisCli 任务队列使用的redis客户端
+func queueRedisCli() redis.UniversalClient {
+	return GetRedisCliNamed(RedisNameQueue)
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"context"
+	"errors"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Envelope 发布订阅消息的统一格式
+type Envelope struct {
+	// Type 消息类型，订阅方根据类型决定如何解析 Payload
+	Type string `json:"type"`
+	// ID 消息ID，可以用于订阅方去重
+	ID string `json:"id"`
+	// Timestamp 发布时间（毫秒时间戳）
+	Timestamp int64 `json:"timestamp"`
+	// Source 发布消息的实例，见 InstanceID
+	Source string `json:"source"`
+	// RequestID 发布消息时所在请求的ID，订阅方处理消息时会写入 context
+	RequestID string `json:"requestId,omitempty"`
+	// Payload 消息内容
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Decode 将消息内容解析到 v 中
+func (e *Envelope) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// EnvelopeHandler 统一格式消息的处理函数，ctx 中携带发布消息时的请求ID
+type EnvelopeHandler func(ctx context.Context, channel string, env *Envelope)
+
+// NewEnvelope 使用 utils/json 序列化消息内容，生成统一格式的消息
+func NewEnvelope(ctx context.Context, msgType string, payload interface{}) (*Envelope, error) {
+	if msgType == "" {
+		return nil, errors.New("envelope type must not be empty")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		Type:      msgType,
+		ID:        NewRequestID(),
+		Timestamp: nowMillis(),
+		Source:    InstanceID(),
+		RequestID: RequestIDFromContext(ctx),
+		Payload:   data,
+	}, nil
+}
+
+// Publish 将消息内容包装为统一格式后发布到指定通道，返回发布的消息与收到消息的订阅方数量
+func Publish(ctx context.Context, channel, msgType string, payload interface{}) (env *Envelope, receivers int64, err error) {
+	env, err = NewEnvelope(ctx, msgType, payload)
+	if err != nil {
+		return
+	}
+	data, err := json.MarshalString(env)
+	if err != nil {
+		return
+	}
+	receivers, err = pubSubRedisCli().Publish(ctx, channel, data).Result()
+	if err != nil {
+		return
+	}
+	GetLogger().Debug("publish redis message",
+		zap.String("channel", channel),
+		zap.String("type", msgType),
+		zap.String("id", env.ID),
+		zap.Int64("receivers", receivers),
+		requestIDField(ctx),
+	)
+	return
+}
+
+// SubscribeEnvelope 订阅统一格式的消息，无法解析的消息会被忽略
+// 参数含义与 SubscribeWithOptions 相同
+func (p redisSubscriptionPool) SubscribeEnvelope(ctx context.Context, handler EnvelopeHandler, channel string,
+	opts *ConsumerOptions) (loaded bool, err error) {
+	return p.SubscribeWithOptions(ctx, envelopeHandler(handler), channel, opts)
+}
+
+// PSubscribeEnvelope 使用通配符模式订阅统一格式的消息，无法解析的消息会被忽略
+func (p redisSubscriptionPool) PSubscribeEnvelope(ctx context.Context, handler EnvelopeHandler, pattern string,
+	opts *ConsumerOptions) (loaded bool, err error) {
+	return p.PSubscribeWithOptions(ctx, envelopeHandler(handler), pattern, opts)
+}
+
+// envelopeHandler 将统一格式消息的处理函数转换为 MessageHandler
+func envelopeHandler(handler EnvelopeHandler) MessageHandler {
+	return func(ctx context.Context, msg *redis.Message) {
+		env := new(Envelope)
+		if err := json.UnmarshalString(msg.Payload, env); err != nil || env.Type == "" {
+			GetLogger().Warn("ignore invalid envelope message",
+				zap.String("channel", msg.Channel),
+				zap.String("payload", msg.Payload),
+				zap.Error(err),
+			)
+			return
+		}
+		if env.RequestID != "" {
+			ctx = WithRequestID(ctx, env.RequestID)
+		}
+		handler(ctx, msg.Channel, env)
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope(t *testing.T) {
+	type payload struct {
+		Key string `json:"key"`
+	}
+
+	ctx := WithRequestID(context.Background(), "testing-request")
+	env, err := NewEnvelope(ctx, "cache-delete", &payload{Key: "testing:key"})
+	assert.NoError(t, err)
+	assert.Equal(t, "cache-delete", env.Type)
+	assert.Equal(t, InstanceID(), env.Source)
+	assert.Equal(t, "testing-request", env.RequestID)
+	assert.NotEmpty(t, env.ID)
+	assert.NotZero(t, env.Timestamp)
+
+	_, err = NewEnvelope(ctx, "", nil)
+	assert.Error(t, err)
+
+	data, err := json.MarshalString(env)
+	assert.NoError(t, err)
+
+	var received *Envelope
+	var requestID string
+	handler := envelopeHandler(func(ctx context.Context, channel string, env *Envelope) {
+		assert.Equal(t, "testing:publish", channel)
+		received, requestID = env, RequestIDFromContext(ctx)
+	})
+	handler(context.Background(), &redis.Message{Channel: "testing:publish", Payload: data})
+	assert.Equal(t, env.ID, received.ID)
+	assert.Equal(t, "testing-request", requestID)
+	var p payload
+	assert.NoError(t, received.Decode(&p))
+	assert.Equal(t, "testing:key", p.Key)
+
+	received = nil
+	handler(context.Background(), &redis.Message{Channel: "testing:publish", Payload: "not json"})
+	handler(context.Background(), &redis.Message{Channel: "testing:publish", Payload: `{"id":"1"}`})
+	assert.Nil(t, received)
+}
@@ -2,38 +2,137 @@ package utils
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/frank-yf/go-web-example/utils/json"
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 )
 
+const (
+	// SubscriptionPending 订阅连接尚未建立
+	SubscriptionPending = "pending"
+	// SubscriptionActive 订阅连接正常接收消息
+	SubscriptionActive = "active"
+	// SubscriptionReconnecting 共享的订阅连接断开，正在等待重新订阅
+	SubscriptionReconnecting = "reconnecting"
+	// SubscriptionFailed 重新订阅的次数超过上限，不再重试
+	SubscriptionFailed = "failed"
+)
+
 var (
+	redisSubOpts     *SubscriptionOptions
 	redisSubPool     *redisSubscriptionPool
 	redisSubPoolOnce sync.Once
 )
 
+// SubscriptionOptions redis订阅的重连配置
+type SubscriptionOptions struct {
+	// InitialBackoff、MaxBackoff 重新订阅的退避等待时长与上限
+	InitialBackoff Duration `json:"initialBackoff"`
+	MaxBackoff     Duration `json:"maxBackoff"`
+	// MaxAttempts 连续重新订阅失败的次数上限，超过后订阅进入 failed 状态，为0时不限制
+	MaxAttempts int `json:"maxAttempts"`
+	// HealthCheck 超过该时长没有收到消息时发送 ping 检查订阅连接
+	HealthCheck Duration `json:"healthCheck"`
+}
+
+// DefaultSubscriptionOptions 默认的redis订阅配置
+func DefaultSubscriptionOptions() *SubscriptionOptions {
+	return &SubscriptionOptions{
+		InitialBackoff: Duration(500 * time.Millisecond),
+		MaxBackoff:     Duration(30 * time.Second),
+		MaxAttempts:    0,
+		HealthCheck:    Duration(30 * time.Second),
+	}
+}
+
+// UnmarshalJSON 在默认配置的基础上反序列化，未声明的项使用默认值
+func (o *SubscriptionOptions) UnmarshalJSON(data []byte) error {
+	type plain SubscriptionOptions
+	opts := (*plain)(DefaultSubscriptionOptions())
+	if err := json.Unmarshal(data, opts); err != nil {
+		return err
+	}
+	*o = SubscriptionOptions(*opts)
+	return nil
+}
+
+// InitRedisSubPool 根据配置初始化redis订阅连接池，需要在首次调用 GetRedisSubPool 之前执行
+func InitRedisSubPool(opts *SubscriptionOptions) {
+	redisSubOpts = opts
+}
+
 // GetRedisSubPool 获取redis订阅连接池
 func GetRedisSubPool() *redisSubscriptionPool {
 	redisSubPoolOnce.Do(func() {
-		redisSubPool = &redisSubscriptionPool{
-			m:      new(sync.Map),
-			length: new(int32),
-			ctx:    GetRedisCli().Context(),
+		opts := redisSubOpts
+		if opts == nil {
+			opts = DefaultSubscriptionOptions()
 		}
+		redisSubPool = newRedisSubscriptionPool(pubSubRedisCli().Context(), opts)
 		GetLogger().Info("redis subscription pool ready...")
 	})
 	return redisSubPool
 }
 
+// RedisSubscriptionInfo 订阅的运行状态
+type RedisSubscriptionInfo struct {
+	// Channel、Pattern 订阅的通道或通配符模式，二者只有一个有值
+	Channel string `json:"channel,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	State   string `json:"state"`
+	// Handler 注册的处理函数名称，直接传入处理函数的订阅为空
+	Handler string `json:"handler,omitempty"`
+	// Messages 收到的消息数
+	Messages uint64 `json:"messages"`
+	// Processed 处理完成的消息数，包含处理超时与发生 panic 的消息
+	Processed uint64 `json:"processed"`
+	// Dropped 因为缓冲区已满或取消订阅而丢弃的消息数
+	Dropped uint64 `json:"dropped"`
+	// Pending 缓冲区中等待处理的消息数
+	Pending int `json:"pending"`
+	// Timeouts 处理超时的消息数
+	Timeouts uint64 `json:"timeouts"`
+	// Panics 处理消息时发生 panic 的次数
+	Panics uint64 `json:"panics"`
+	// Reconnects 重新订阅的次数
+	Reconnects uint64 `json:"reconnects"`
+	// LastMessageAt 最近一次收到消息的时间
+	LastMessageAt *time.Time `json:"lastMessageAt,omitempty"`
+	// LastError 最近一次订阅连接断开的原因
+	LastError string `json:"lastError,omitempty"`
+	// Consumer 消息的处理配置
+	Consumer *ConsumerOptions `json:"consumer"`
+}
+
 // redisSubscriptionPool redis订阅连接池
+// 所有通道与通配符模式的订阅共享同一个订阅连接，每个订阅有各自的消息处理函数
 type redisSubscriptionPool struct {
-	m      *sync.Map
-	length *int32
+	// m、patterns 分别保存通道与通配符模式的订阅
+	m        *sync.Map
+	patterns *sync.Map
+	length   *int32
 
 	// ctx 连接池中全局设定的context，当订阅事件没有设定例外的context，则以此为准
-	ctx context.Context
+	ctx  context.Context
+	opts *SubscriptionOptions
+	conn *redisPubSubConn
+}
+
+func newRedisSubscriptionPool(ctx context.Context, opts *SubscriptionOptions) *redisSubscriptionPool {
+	p := &redisSubscriptionPool{
+		m:        new(sync.Map),
+		patterns: new(sync.Map),
+		length:   new(int32),
+		ctx:      ctx,
+		opts:     opts,
+	}
+	p.conn = &redisPubSubConn{pool: p}
+	return p
 }
 
 func (p redisSubscriptionPool) withContext(ctx context.Context) context.Context {
@@ -43,94 +142,292 @@ func (p redisSubscriptionPool) withContext(ctx context.Context) context.Context
 	return p.ctx
 }
 
-// Subscribe 注册订阅事件
+// Subscribe 注册通道的订阅事件，订阅连接断开后会按退避策略自动重新订阅
+// 订阅在 ctx 结束或取消订阅时停止，ctx 为空时使用连接池的 context
 func (p redisSubscriptionPool) Subscribe(ctx context.Context, consume func(*redis.Message), channel string) (loaded bool) {
-	pubSub := GetRedisCli().Subscribe(p.withContext(ctx), channel)
-	_, loaded = p.m.LoadOrStore(channel, pubSub)
-	if !loaded {
-		// 订阅事件不存在，则订阅到redis客户端
-		Go(func() {
-			ch := pubSub.Channel()
-			for msg := range ch {
-				consume(msg)
-				GetLogger().Debug("consume subscribe message", zap.String("message", msg.String()))
-			}
-			GetLogger().Debug("subscribe channel is stopped", zap.String("channel", channel))
-		})
-		atomic.AddInt32(p.length, 1)
-		GetLogger().Info("registe redis subscribe", zap.String("channel", channel))
-	} else {
-		// 订阅事件已存在，将新建的订阅连接关闭掉，避免连接逃逸
-		err := pubSub.Close()
-		if err != nil {
-			GetLogger().Error("close escape redis subscription connection error", zap.Error(err))
+	// 默认的处理配置总是有效的
+	_, loaded, _ = p.subscribe(ctx, consumeHandler(consume), "", channel, false, nil)
+	return
+}
+
+// SubscribeWithOptions 注册通道的订阅事件，并指定消息的处理配置，opts 为空时使用默认配置，配置无效时返回错误
+func (p redisSubscriptionPool) SubscribeWithOptions(ctx context.Context, handler MessageHandler, channel string,
+	opts *ConsumerOptions) (loaded bool, err error) {
+	_, loaded, err = p.subscribe(ctx, handler, "", channel, false, opts)
+	return
+}
+
+// PSubscribe 注册通配符模式的订阅事件，模式的语法与redis PSUBSCRIBE 命令相同
+// 同一条消息同时匹配通道与模式的订阅时，两者都会收到
+func (p redisSubscriptionPool) PSubscribe(ctx context.Context, consume func(*redis.Message), pattern string) (loaded bool) {
+	_, loaded, _ = p.subscribe(ctx, consumeHandler(consume), "", pattern, true, nil)
+	return
+}
+
+// PSubscribeWithOptions 注册通配符模式的订阅事件，并指定消息的处理配置，opts 为空时使用默认配置，配置无效时返回错误
+func (p redisSubscriptionPool) PSubscribeWithOptions(ctx context.Context, handler MessageHandler, pattern string,
+	opts *ConsumerOptions) (loaded bool, err error) {
+	_, loaded, err = p.subscribe(ctx, handler, "", pattern, true, opts)
+	return
+}
+
+// subscribe 注册订阅事件，handlerName 为注册的处理函数名称，直接传入处理函数时为空
+// 已有的订阅因为重试次数超过上限而失败时，使用新的订阅替换并重新启动订阅连接
+func (p redisSubscriptionPool) subscribe(ctx context.Context, handler MessageHandler, handlerName, name string,
+	pattern bool, opts *ConsumerOptions) (sub *redisSubscription, loaded bool, err error) {
+	if opts, err = opts.complete(); err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(p.withContext(ctx))
+	sub = &redisSubscription{
+		name:        name,
+		pattern:     pattern,
+		handler:     handler,
+		handlerName: handlerName,
+		opts:        opts,
+		queue:       make(chan *redis.Message, opts.BufferSize),
+		ctx:         ctx,
+		cancel:      cancel,
+		state:       SubscriptionPending,
+	}
+	for {
+		v, ok := p.subscriptions(pattern).LoadOrStore(name, sub)
+		if !ok {
+			break
+		}
+		old := v.(*redisSubscription)
+		if !old.failed() {
+			cancel()
+			return old, true, nil
 		}
+		// 先从池中移除，避免失败订阅的 ctx 结束后移除新的订阅
+		p.remove(old)
+		old.cancel()
 	}
+	atomic.AddInt32(p.length, 1)
+	sub.startConsumers()
+	p.conn.subscribe(sub)
+
+	// ctx 结束时取消订阅
+	Go(func() {
+		<-ctx.Done()
+		p.remove(sub)
+	})
+	GetLogger().Info("registe redis subscribe", zap.String("name", name), zap.Bool("pattern", pattern))
 	return
 }
 
-// Unsubscribe 取消订阅事件
+// consumeHandler 将不关心 ctx 的处理函数转换为 MessageHandler
+func consumeHandler(consume func(*redis.Message)) MessageHandler {
+	return func(_ context.Context, msg *redis.Message) {
+		consume(msg)
+	}
+}
+
+// Unsubscribe 取消通道的订阅事件
 // 如果订阅通道存在，则取消订阅事件；假如不存在则loaded会返回false
 func (p redisSubscriptionPool) Unsubscribe(ctx context.Context, channel string) (loaded bool, err error) {
-	v, loaded := p.m.LoadAndDelete(channel)
+	return p.unsubscribe(ctx, channel, false)
+}
+
+// PUnsubscribe 取消通配符模式的订阅事件，假如不存在则loaded会返回false
+func (p redisSubscriptionPool) PUnsubscribe(ctx context.Context, pattern string) (loaded bool, err error) {
+	return p.unsubscribe(ctx, pattern, true)
+}
+
+func (p redisSubscriptionPool) unsubscribe(ctx context.Context, name string, pattern bool) (loaded bool, err error) {
+	v, loaded := p.subscriptions(pattern).LoadAndDelete(name)
 	if loaded {
-		pubSub := v.(*redis.PubSub)
-		err = p.unsubscribe(ctx, channel, pubSub)
+		sub := v.(*redisSubscription)
+		sub.cancel()
+		err = p.conn.unsubscribe(p.withContext(ctx), sub)
+		p.release(sub)
+		GetLogger().Debug("subscribe is canceled", zap.String("name", name), zap.Bool("pattern", pattern))
 	}
 	return
 }
 
-// Close 关闭订阅连接池，取消已订阅的所有事件
-// 当遇到无法正确关闭的订阅连接时，之后的所有订阅连接将不会被关闭，操作失败
+// Close 关闭订阅连接池，取消已订阅的所有事件并关闭共享的订阅连接
 func (p *redisSubscriptionPool) Close() (err error) {
-	p.m.Range(func(k, v interface{}) bool {
-		err = p.unsubscribe(nil, k.(string), v.(*redis.PubSub))
-		suc := err == nil
-		if suc {
-			p.m.Delete(k)
-		}
-		return suc
-	})
-	if err == nil {
+	for _, m := range []*sync.Map{p.m, p.patterns} {
+		m.Range(func(k, v interface{}) bool {
+			sub := v.(*redisSubscription)
+			m.Delete(k)
+			sub.cancel()
+			p.release(sub)
+			return true
+		})
+	}
+	if err = p.conn.close(); err == nil {
 		GetLogger().Debug("redis subscription pool closed")
 	}
 	return
 }
 
-// unsubscribe 取消订阅事件
-// 假如抛出异常即表示订阅事件未能成功取消，redis连接没有被释放
-func (p redisSubscriptionPool) unsubscribe(ctx context.Context, channel string, pubSub *redis.PubSub) (err error) {
-	// 从redis客户端取消订阅
-	err = pubSub.Unsubscribe(p.withContext(ctx), channel)
-	if err != nil {
+// remove 订阅因为 ctx 结束而停止时，从池中移除
+func (p redisSubscriptionPool) remove(sub *redisSubscription) {
+	m := p.subscriptions(sub.pattern)
+	if v, ok := m.Load(sub.name); !ok || v != sub {
 		return
 	}
-	GetLogger().Debug("subscribe is canceled", zap.String("channel", channel))
+	m.Delete(sub.name)
+	if err := p.conn.unsubscribe(p.ctx, sub); err != nil {
+		GetLogger().Warn("unsubscribe redis error", zap.String("name", sub.name), zap.Error(err))
+	}
+	p.release(sub)
+}
 
-	// 关闭订阅连接
-	err = pubSub.Close()
-	if err != nil {
-		return
+// release 池中订阅数递减，每个订阅只会递减一次
+func (p redisSubscriptionPool) release(sub *redisSubscription) {
+	if atomic.CompareAndSwapInt32(&sub.released, 0, 1) {
+		atomic.AddInt32(p.length, -1)
+	}
+}
+
+func (p redisSubscriptionPool) subscriptions(pattern bool) *sync.Map {
+	if pattern {
+		return p.patterns
 	}
-	GetLogger().Debug("subscribe connection is closed", zap.String("channel", channel))
+	return p.m
+}
 
-	// 池中订阅数递减
-	atomic.AddInt32(p.length, -1)
-	return
+// lookup 查找订阅，消息匹配通配符模式时 pattern 为模式
+func (p redisSubscriptionPool) lookup(name string, pattern bool) (*redisSubscription, bool) {
+	v, ok := p.subscriptions(pattern).Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(*redisSubscription), true
 }
 
-// Lookup 查看已订阅的通道名称
-func (p redisSubscriptionPool) Lookup() (channels []string) {
-	channels = make([]string, 0, p.Len())
+// names 所有订阅的通道与通配符模式
+func (p redisSubscriptionPool) names() (channels, patterns []string) {
 	p.m.Range(func(k, _ interface{}) bool {
 		channels = append(channels, k.(string))
 		return true
 	})
+	p.patterns.Range(func(k, _ interface{}) bool {
+		patterns = append(patterns, k.(string))
+		return true
+	})
 	return
 }
 
-// Len 订阅池中已有的订阅连接
+// empty 池中是否没有任何订阅
+func (p redisSubscriptionPool) empty() bool {
+	empty := true
+	p.each(func(*redisSubscription) {
+		empty = false
+	})
+	return empty
+}
+
+// each 遍历所有的订阅
+func (p redisSubscriptionPool) each(fn func(*redisSubscription)) {
+	for _, m := range []*sync.Map{p.m, p.patterns} {
+		m.Range(func(_, v interface{}) bool {
+			fn(v.(*redisSubscription))
+			return true
+		})
+	}
+}
+
+// Lookup 查看已订阅的通道及其运行状态，按通道名称排序
+func (p redisSubscriptionPool) Lookup() []*RedisSubscriptionInfo {
+	return lookupSubscriptions(p.m)
+}
+
+// LookupPatterns 查看已订阅的通配符模式及其运行状态，按模式排序
+func (p redisSubscriptionPool) LookupPatterns() []*RedisSubscriptionInfo {
+	return lookupSubscriptions(p.patterns)
+}
+
+func lookupSubscriptions(m *sync.Map) (subs []*RedisSubscriptionInfo) {
+	subs = make([]*RedisSubscriptionInfo, 0)
+	m.Range(func(_, v interface{}) bool {
+		subs = append(subs, v.(*redisSubscription).info())
+		return true
+	})
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Channel+subs[i].Pattern < subs[j].Channel+subs[j].Pattern
+	})
+	return
+}
+
+// Len 订阅池中已有的订阅数，包含通道与通配符模式
 func (p redisSubscriptionPool) Len() int {
 	i := atomic.LoadInt32(p.length)
 	return int(i)
 }
+
+// redisSubscription 单个通道或通配符模式的订阅
+type redisSubscription struct {
+	name    string
+	pattern bool
+	handler MessageHandler
+	// handlerName 注册的处理函数名称，见 RegisterSubscribeHandler
+	handlerName string
+	opts        *ConsumerOptions
+	// queue 等待处理的消息缓冲区
+	queue  chan *redis.Message
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	state     string
+	lastError string
+
+	messages      uint64
+	processed     uint64
+	dropped       uint64
+	timeouts      uint64
+	panics        uint64
+	reconnects    uint64
+	lastMessageAt int64
+	released      int32
+}
+
+func (s *redisSubscription) setState(state string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	if err != nil {
+		s.lastError = err.Error()
+	}
+}
+
+// failed 订阅是否因为重试次数超过上限而失败
+func (s *redisSubscription) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state == SubscriptionFailed
+}
+
+func (s *redisSubscription) info() *RedisSubscriptionInfo {
+	s.mu.Lock()
+	info := &RedisSubscriptionInfo{
+		State:      s.state,
+		Handler:    s.handlerName,
+		Messages:   atomic.LoadUint64(&s.messages),
+		Processed:  atomic.LoadUint64(&s.processed),
+		Dropped:    atomic.LoadUint64(&s.dropped),
+		Pending:    len(s.queue),
+		Timeouts:   atomic.LoadUint64(&s.timeouts),
+		Panics:     atomic.LoadUint64(&s.panics),
+		Reconnects: atomic.LoadUint64(&s.reconnects),
+		LastError:  s.lastError,
+		Consumer:   s.opts,
+	}
+	s.mu.Unlock()
+
+	if s.pattern {
+		info.Pattern = s.name
+	} else {
+		info.Channel = s.name
+	}
+	if ns := atomic.LoadInt64(&s.lastMessageAt); ns > 0 {
+		t := time.Unix(0, ns)
+		info.LastMessageAt = &t
+	}
+	return info
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// redisPubSubConn 所有订阅共享的订阅连接
+// 存在订阅时建立连接，连接断开后按退避策略重新连接并恢复所有订阅，所有订阅取消后关闭连接
+type redisPubSubConn struct {
+	pool *redisSubscriptionPool
+
+	mu     sync.Mutex
+	pubSub *redis.PubSub
+	// cancel、done 正在运行的连接 goroutine，未运行时 cancel 为 nil
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// subscribe 在共享连接上订阅，连接未建立时会在建立连接后一并订阅
+func (c *redisPubSubConn) subscribe(sub *redisSubscription) {
+	c.mu.Lock()
+	if c.cancel == nil {
+		c.start()
+		c.mu.Unlock()
+		return
+	}
+	pubSub := c.pubSub
+	c.mu.Unlock()
+	if pubSub == nil {
+		return
+	}
+
+	var err error
+	if sub.pattern {
+		err = pubSub.PSubscribe(sub.ctx, sub.name)
+	} else {
+		err = pubSub.Subscribe(sub.ctx, sub.name)
+	}
+	if err != nil {
+		// 连接断开时由 run 重新连接并恢复订阅
+		GetLogger().Warn("redis subscribe error", zap.String("name", sub.name), zap.Error(err))
+	}
+}
+
+// unsubscribe 在共享连接上取消订阅，没有其他订阅时关闭连接
+func (c *redisPubSubConn) unsubscribe(ctx context.Context, sub *redisSubscription) error {
+	c.mu.Lock()
+	if c.pool.empty() {
+		pubSub := c.stop()
+		c.mu.Unlock()
+		return closePubSub(pubSub)
+	}
+	pubSub := c.pubSub
+	c.mu.Unlock()
+	if pubSub == nil {
+		return nil
+	}
+
+	if sub.pattern {
+		return pubSub.PUnsubscribe(ctx, sub.name)
+	}
+	return pubSub.Unsubscribe(ctx, sub.name)
+}
+
+// close 关闭共享连接并等待连接 goroutine 退出
+func (c *redisPubSubConn) close() (err error) {
+	c.mu.Lock()
+	done := c.done
+	pubSub := c.stop()
+	c.mu.Unlock()
+
+	err = closePubSub(pubSub)
+	if done != nil {
+		<-done
+	}
+	return
+}
+
+// start 启动连接 goroutine，调用方需要持有锁
+func (c *redisPubSubConn) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.cancel, c.done = cancel, done
+	Go(func() {
+		c.run(ctx, done)
+	})
+}
+
+// stop 停止连接 goroutine，返回需要关闭的订阅连接，调用方需要持有锁
+func (c *redisPubSubConn) stop() (pubSub *redis.PubSub) {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	pubSub = c.pubSub
+	c.cancel, c.pubSub = nil, nil
+	return
+}
+
+// run 建立连接并接收消息，连接断开后按退避策略重新连接，直到 ctx 结束或重试次数超过上限
+func (c *redisPubSubConn) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	opts := c.pool.opts
+	backoff := Backoff{Initial: opts.InitialBackoff.Std(), Max: opts.MaxBackoff.Std()}
+
+	for attempt := 0; ; {
+		pubSub, err := c.connect(ctx)
+		if err == nil {
+			attempt = 0
+			err = c.receive(ctx, pubSub)
+		}
+		c.release(pubSub)
+		if ctx.Err() != nil {
+			return
+		}
+
+		attempt++
+		if opts.MaxAttempts > 0 && attempt > opts.MaxAttempts {
+			c.pool.each(func(sub *redisSubscription) {
+				sub.setState(SubscriptionFailed, err)
+			})
+			GetLogger().Error("redis subscribe failed, give up",
+				zap.Int("attempts", attempt-1),
+				zap.Error(err),
+			)
+			// 之后有新的订阅时重新启动连接 goroutine
+			c.mu.Lock()
+			if c.done == done {
+				c.stop()
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		wait := backoff.Duration(attempt - 1)
+		c.pool.each(func(sub *redisSubscription) {
+			sub.setState(SubscriptionReconnecting, err)
+		})
+		GetLogger().Warn("redis subscribe interrupted, resubscribe later",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", wait),
+			zap.Error(err),
+		)
+		if !sleepContext(ctx, wait) {
+			return
+		}
+		c.pool.each(func(sub *redisSubscription) {
+			atomic.AddUint64(&sub.reconnects, 1)
+		})
+	}
+}
+
+// connect 建立订阅连接并订阅池中所有的通道与通配符模式
+func (c *redisPubSubConn) connect(ctx context.Context) (*redis.PubSub, error) {
+	c.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	// 持有锁收集订阅并保存连接，之后新增的订阅由 subscribe 在该连接上订阅
+	channels, patterns := c.pool.names()
+	pubSub := pubSubRedisCli().Subscribe(ctx)
+	c.pubSub = pubSub
+	c.mu.Unlock()
+
+	if len(channels) > 0 {
+		if err := pubSub.Subscribe(ctx, channels...); err != nil {
+			return pubSub, err
+		}
+	}
+	if len(patterns) > 0 {
+		if err := pubSub.PSubscribe(ctx, patterns...); err != nil {
+			return pubSub, err
+		}
+	}
+	GetLogger().Debug("redis subscription connection is ready",
+		zap.Strings("channels", channels),
+		zap.Strings("patterns", patterns),
+	)
+	return pubSub, nil
+}
+
+// receive 接收消息并分发到对应的订阅，超过健康检查时长没有消息时使用 ping 检查订阅连接
+func (c *redisPubSubConn) receive(ctx context.Context, pubSub *redis.PubSub) error {
+	timeout := c.pool.opts.HealthCheck.Std()
+	for {
+		msg, err := pubSub.ReceiveTimeout(ctx, timeout)
+		if err != nil {
+			if classifyRedisError(err) != redisErrTimeout || ctx.Err() != nil {
+				return err
+			}
+			if err = pubSub.Ping(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind != "subscribe" && m.Kind != "psubscribe" {
+				continue
+			}
+			if sub, ok := c.pool.lookup(m.Channel, m.Kind == "psubscribe"); ok {
+				sub.setState(SubscriptionActive, nil)
+			}
+		case *redis.Message:
+			// 匹配通配符模式的消息 Pattern 不为空
+			sub, ok := c.pool.lookup(m.Channel, false)
+			if m.Pattern != "" {
+				sub, ok = c.pool.lookup(m.Pattern, true)
+			}
+			if ok {
+				sub.dispatch(m)
+			}
+		}
+	}
+}
+
+// release 关闭订阅连接
+func (c *redisPubSubConn) release(pubSub *redis.PubSub) {
+	if pubSub == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.pubSub == pubSub {
+		c.pubSub = nil
+	}
+	c.mu.Unlock()
+	_ = pubSub.Close()
+}
+
+// closePubSub 关闭订阅连接，连接已经被关闭时不返回错误
+func closePubSub(pubSub *redis.PubSub) error {
+	if pubSub == nil {
+		return nil
+	}
+	if err := pubSub.Close(); err != nil && err != redis.ErrClosed {
+		return err
+	}
+	return nil
+}
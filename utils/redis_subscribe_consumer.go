@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// OverflowBlock 缓冲区已满时阻塞接收消息，共享的订阅连接上的其他订阅同样会被阻塞，只用于不能丢弃消息且处理足够快的订阅
+	OverflowBlock = "block"
+	// OverflowDropOldest 缓冲区已满时丢弃最早的消息
+	OverflowDropOldest = "drop-oldest"
+	// OverflowDropNewest 缓冲区已满时丢弃新收到的消息
+	OverflowDropNewest = "drop-newest"
+)
+
+const (
+	// maxConsumerConcurrency 单个订阅处理消息的 goroutine 数量上限
+	maxConsumerConcurrency = 64
+	// maxConsumerBufferSize 单个订阅的消息缓冲区大小上限
+	maxConsumerBufferSize = 65536
+)
+
+// MessageHandler 订阅消息的处理函数，ctx 在超过单条消息的处理时长或取消订阅时结束
+type MessageHandler func(ctx context.Context, msg *redis.Message)
+
+// ConsumerOptions 订阅消息的处理配置
+type ConsumerOptions struct {
+	// Concurrency 同时处理消息的 goroutine 数量，大于1时不保证消息的处理顺序，最大为64
+	Concurrency int `json:"concurrency"`
+	// BufferSize 等待处理的消息缓冲区大小，最大为65536
+	BufferSize int `json:"bufferSize"`
+	// Overflow 缓冲区已满时的处理策略，可选 block、drop-oldest、drop-newest，默认 drop-oldest，
+	// 避免处理缓慢的订阅阻塞共享订阅连接上的其他订阅
+	Overflow string `json:"overflow"`
+	// Timeout 单条消息的处理时长，超时后结束处理函数的 ctx，为0时不限制
+	Timeout Duration `json:"timeout"`
+}
+
+func defaultConsumerOptions() *ConsumerOptions {
+	return &ConsumerOptions{
+		Concurrency: 1,
+		BufferSize:  128,
+		Overflow:    OverflowDropOldest,
+	}
+}
+
+// complete 使用默认值补全未配置的项，配置无效时返回错误
+func (o *ConsumerOptions) complete() (*ConsumerOptions, error) {
+	def := defaultConsumerOptions()
+	if o == nil {
+		return def, nil
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	opts := *o
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = def.Concurrency
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = def.BufferSize
+	}
+	if opts.Overflow == "" {
+		opts.Overflow = def.Overflow
+	}
+	if opts.Timeout < 0 {
+		opts.Timeout = 0
+	}
+	return &opts, nil
+}
+
+// validate 检查处理配置，未配置的项视为有效
+func (o *ConsumerOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Concurrency > maxConsumerConcurrency {
+		return fmt.Errorf("subscribe concurrency must not exceed %d", maxConsumerConcurrency)
+	}
+	if o.BufferSize > maxConsumerBufferSize {
+		return fmt.Errorf("subscribe buffer size must not exceed %d", maxConsumerBufferSize)
+	}
+	switch o.Overflow {
+	case "", OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+		return nil
+	}
+	return fmt.Errorf("subscribe overflow must in [%s|%s|%s]", OverflowBlock, OverflowDropOldest, OverflowDropNewest)
+}
+
+// startConsumers 启动处理消息的 goroutine，取消订阅后退出
+func (s *redisSubscription) startConsumers() {
+	for i := 0; i < s.opts.Concurrency; i++ {
+		Go(s.consumeLoop)
+	}
+}
+
+// dispatch 将消息放入缓冲区，缓冲区已满时按 Overflow 策略处理
+func (s *redisSubscription) dispatch(msg *redis.Message) {
+	atomic.AddUint64(&s.messages, 1)
+	atomic.StoreInt64(&s.lastMessageAt, time.Now().UnixNano())
+
+	if s.ctx.Err() != nil {
+		s.drop(msg)
+		return
+	}
+	switch s.opts.Overflow {
+	case OverflowDropNewest:
+		select {
+		case s.queue <- msg:
+		default:
+			s.drop(msg)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.queue <- msg:
+				return
+			default:
+			}
+			select {
+			case old := <-s.queue:
+				s.drop(old)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.queue <- msg:
+		case <-s.ctx.Done():
+			s.drop(msg)
+		}
+	}
+}
+
+func (s *redisSubscription) drop(msg *redis.Message) {
+	atomic.AddUint64(&s.dropped, 1)
+	GetLogger().Debug("drop subscribe message",
+		zap.String("name", s.name),
+		zap.String("overflow", s.opts.Overflow),
+		zap.String("message", msg.String()),
+	)
+}
+
+// consumeLoop 处理缓冲区中的消息，取消订阅后丢弃缓冲区中剩余的消息
+func (s *redisSubscription) consumeLoop() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			s.drain()
+			return
+		case msg := <-s.queue:
+			if s.ctx.Err() != nil {
+				s.drop(msg)
+				continue
+			}
+			s.consume(msg)
+		}
+	}
+}
+
+// drain 丢弃缓冲区中剩余的消息并计入 Dropped
+func (s *redisSubscription) drain() {
+	for {
+		select {
+		case msg := <-s.queue:
+			s.drop(msg)
+		default:
+			return
+		}
+	}
+}
+
+// consume 处理消息，避免 panic 中断订阅
+func (s *redisSubscription) consume(msg *redis.Message) {
+	ctx := s.ctx
+	if s.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.Timeout.Std())
+		defer cancel()
+	}
+	defer func() {
+		if res := recover(); res != nil {
+			atomic.AddUint64(&s.panics, 1)
+			GetLogger().Error("consume subscribe message panic",
+				zap.String("name", s.name),
+				zap.Any("panic", res),
+				zap.String("stack", string(debug.Stack())),
+			)
+		}
+	}()
+	defer atomic.AddUint64(&s.processed, 1)
+
+	start := time.Now()
+	s.handler(ctx, msg)
+	if ctx.Err() == context.DeadlineExceeded {
+		atomic.AddUint64(&s.timeouts, 1)
+		GetLogger().Warn("consume subscribe message timeout",
+			zap.String("name", s.name),
+			zap.Duration("elapsed", time.Since(start)),
+		)
+	}
+	GetLogger().Debug("consume subscribe message", zap.String("message", msg.String()))
+}
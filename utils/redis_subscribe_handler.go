@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// SubscribeHandlerCacheDelete 消息内容为缓存键，删除对应的本地缓存
+	SubscribeHandlerCacheDelete = "cache-delete"
+	// SubscribeHandlerCacheInvalidate 处理缓存失效广播，见 CacheInvalidateChannel
+	SubscribeHandlerCacheInvalidate = "cache-invalidate"
+	// SubscribeHandlerLog 只记录收到的消息，用于排查发布方的问题
+	SubscribeHandlerLog = "log"
+)
+
+var (
+	// ErrSubscribeHandlerNotFound 订阅的处理函数没有注册
+	ErrSubscribeHandlerNotFound = errors.New("subscribe handler not found")
+	// ErrSubscriptionExists 通道或通配符模式已经被订阅
+	ErrSubscriptionExists = errors.New("subscription already exists")
+
+	subscribeHandlers = map[string]MessageHandler{
+		SubscribeHandlerCacheDelete:     consumeHandler(DeleteCacheFromRedisMessage),
+		SubscribeHandlerCacheInvalidate: consumeHandler(consumeCacheInvalidate),
+		SubscribeHandlerLog:             logSubscribeMessage,
+	}
+	subscribeHandlersMu sync.RWMutex
+)
+
+// RegisterSubscribeHandler 注册命名的订阅处理函数，只有注册过的处理函数才能通过管理接口订阅
+// 名称重复时 panic，需要在启动阶段调用
+func RegisterSubscribeHandler(name string, handler MessageHandler) {
+	subscribeHandlersMu.Lock()
+	defer subscribeHandlersMu.Unlock()
+	if _, ok := subscribeHandlers[name]; ok {
+		panic(fmt.Sprintf("subscribe handler '%s' already registered", name))
+	}
+	subscribeHandlers[name] = handler
+}
+
+// SubscribeHandlers 已注册的订阅处理函数名称，按名称排序
+func SubscribeHandlers() []string {
+	subscribeHandlersMu.RLock()
+	defer subscribeHandlersMu.RUnlock()
+	names := make([]string, 0, len(subscribeHandlers))
+	for name := range subscribeHandlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func subscribeHandler(name string) (MessageHandler, bool) {
+	subscribeHandlersMu.RLock()
+	defer subscribeHandlersMu.RUnlock()
+	handler, ok := subscribeHandlers[name]
+	return handler, ok
+}
+
+// SubscribeNamed 使用已注册的处理函数订阅通道，pattern 为 true 时订阅通配符模式
+// 订阅随连接池的 context 结束，处理函数未注册时返回 ErrSubscribeHandlerNotFound，已经订阅时返回 ErrSubscriptionExists
+func (p redisSubscriptionPool) SubscribeNamed(handlerName, name string, pattern bool,
+	opts *ConsumerOptions) (*RedisSubscriptionInfo, error) {
+	handler, ok := subscribeHandler(handlerName)
+	if !ok {
+		return nil, ErrSubscribeHandlerNotFound
+	}
+	sub, loaded, err := p.subscribe(nil, handler, handlerName, name, pattern, opts)
+	if err != nil {
+		return nil, err
+	}
+	if loaded {
+		return nil, ErrSubscriptionExists
+	}
+	return sub.info(), nil
+}
+
+// logSubscribeMessage 记录收到的消息
+func logSubscribeMessage(_ context.Context, msg *redis.Message) {
+	GetLogger().Info("receive subscribe message",
+		zap.String("channel", msg.Channel),
+		zap.String("pattern", msg.Pattern),
+		zap.String("payload", msg.Payload),
+	)
+}
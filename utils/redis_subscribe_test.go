@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestingSubPool() *redisSubscriptionPool {
+	return newRedisSubscriptionPool(context.Background(), &SubscriptionOptions{
+		InitialBackoff: Duration(10 * time.Millisecond),
+		MaxBackoff:     Duration(50 * time.Millisecond),
+		HealthCheck:    Duration(100 * time.Millisecond),
+	})
+}
+
+func TestRedisSubscriptionPool(t *testing.T) {
+	p := newTestingSubPool()
+	consume := func(*redis.Message) {}
+
+	assert.False(t, p.Subscribe(nil, consume, "testing:a"))
+	assert.True(t, p.Subscribe(nil, consume, "testing:a"))
+	assert.False(t, p.Subscribe(nil, consume, "testing:b"))
+	assert.False(t, p.PSubscribe(nil, consume, "testing:*"))
+	assert.True(t, p.PSubscribe(nil, consume, "testing:*"))
+	assert.Equal(t, 3, p.Len())
+
+	subs := p.Lookup()
+	assert.Len(t, subs, 2)
+	assert.Equal(t, "testing:a", subs[0].Channel)
+	assert.Equal(t, "testing:b", subs[1].Channel)
+	patterns := p.LookupPatterns()
+	assert.Len(t, patterns, 1)
+	assert.Equal(t, "testing:*", patterns[0].Pattern)
+	assert.Empty(t, patterns[0].Channel)
+
+	loaded, err := p.PUnsubscribe(context.TODO(), "testing:*")
+	assert.True(t, loaded)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, p.Len())
+
+	loaded, err = p.Unsubscribe(context.TODO(), "testing:a")
+	assert.True(t, loaded)
+	assert.Nil(t, err)
+	loaded, _ = p.Unsubscribe(context.TODO(), "testing:a")
+	assert.False(t, loaded)
+	assert.Equal(t, 1, p.Len())
+
+	assert.Nil(t, p.Close())
+	assert.Equal(t, 0, p.Len())
+	assert.Empty(t, p.Lookup())
+}
+
+func TestRedisSubscriptionContextDone(t *testing.T) {
+	p := newTestingSubPool()
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Subscribe(ctx, func(*redis.Message) {}, "testing:ctx")
+	assert.Equal(t, 1, p.Len())
+
+	cancel()
+	assert.Eventually(t, func() bool { return p.Len() == 0 }, time.Second, 10*time.Millisecond)
+	assert.Empty(t, p.Lookup())
+}
+
+func newTestingSubscription(handler MessageHandler, opts *ConsumerOptions) *redisSubscription {
+	opts, _ = opts.complete()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &redisSubscription{
+		name:    "testing",
+		handler: handler,
+		opts:    opts,
+		queue:   make(chan *redis.Message, opts.BufferSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func TestRedisSubscriptionConsumePanic(t *testing.T) {
+	sub := newTestingSubscription(func(context.Context, *redis.Message) { panic("boom") }, nil)
+	sub.consume(&redis.Message{Channel: "testing", Payload: "x"})
+	info := sub.info()
+	assert.Equal(t, uint64(1), info.Panics)
+	assert.Equal(t, uint64(1), info.Processed)
+}
+
+func TestRedisSubscriptionConsumeTimeout(t *testing.T) {
+	sub := newTestingSubscription(func(ctx context.Context, _ *redis.Message) {
+		<-ctx.Done()
+	}, &ConsumerOptions{Timeout: Duration(10 * time.Millisecond)})
+	sub.consume(&redis.Message{Channel: "testing", Payload: "x"})
+	assert.Equal(t, uint64(1), sub.info().Timeouts)
+}
+
+func TestRedisSubscriptionOverflow(t *testing.T) {
+	payloads := func(sub *redisSubscription) (res []string) {
+		for len(sub.queue) > 0 {
+			res = append(res, (<-sub.queue).Payload)
+		}
+		return
+	}
+	handler := func(context.Context, *redis.Message) {}
+
+	for _, c := range []struct {
+		overflow string
+		expected []string
+	}{
+		{OverflowDropOldest, []string{"2", "3"}},
+		{OverflowDropNewest, []string{"1", "2"}},
+	} {
+		sub := newTestingSubscription(handler, &ConsumerOptions{BufferSize: 2, Overflow: c.overflow})
+		for _, payload := range []string{"1", "2", "3"} {
+			sub.dispatch(&redis.Message{Channel: "testing", Payload: payload})
+		}
+		info := sub.info()
+		assert.Equal(t, uint64(3), info.Messages, c.overflow)
+		assert.Equal(t, uint64(1), info.Dropped, c.overflow)
+		assert.Equal(t, 2, info.Pending, c.overflow)
+		assert.Equal(t, c.expected, payloads(sub), c.overflow)
+	}
+
+	// 阻塞策略在取消订阅后丢弃消息
+	sub := newTestingSubscription(handler, &ConsumerOptions{BufferSize: 1, Overflow: OverflowBlock})
+	sub.dispatch(&redis.Message{Channel: "testing", Payload: "1"})
+	sub.cancel()
+	sub.dispatch(&redis.Message{Channel: "testing", Payload: "2"})
+	assert.Equal(t, uint64(1), sub.info().Dropped)
+
+	// 取消订阅时缓冲区中剩余的消息同样计入丢弃数
+	sub.consumeLoop()
+	info := sub.info()
+	assert.Equal(t, uint64(2), info.Dropped)
+	assert.Equal(t, uint64(0), info.Processed)
+	assert.Equal(t, 0, info.Pending)
+}
+
+func TestRedisSubscriptionConcurrency(t *testing.T) {
+	var running, peak int32
+	release := make(chan struct{})
+	sub := newTestingSubscription(func(context.Context, *redis.Message) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+	}, &ConsumerOptions{Concurrency: 2, BufferSize: 8})
+	defer sub.cancel()
+	sub.startConsumers()
+
+	for i := 0; i < 4; i++ {
+		sub.dispatch(&redis.Message{Channel: "testing", Payload: "x"})
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&running) == 2 }, time.Second, 5*time.Millisecond)
+	close(release)
+	assert.Eventually(t, func() bool { return sub.info().Processed == 4 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
+
+func TestConsumerOptionsComplete(t *testing.T) {
+	opts, err := (&ConsumerOptions{Overflow: OverflowDropNewest}).complete()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, opts.Concurrency)
+	assert.Equal(t, 128, opts.BufferSize)
+	assert.Equal(t, OverflowDropNewest, opts.Overflow)
+	opts, _ = (&ConsumerOptions{}).complete()
+	assert.Equal(t, OverflowDropOldest, opts.Overflow)
+	_, err = (&ConsumerOptions{Overflow: "unknown"}).complete()
+	assert.NotNil(t, err)
+	_, err = (&ConsumerOptions{Concurrency: maxConsumerConcurrency + 1}).complete()
+	assert.NotNil(t, err)
+	_, err = (&ConsumerOptions{BufferSize: maxConsumerBufferSize + 1}).complete()
+	assert.NotNil(t, err)
+
+	p := newTestingSubPool()
+	_, err = p.SubscribeWithOptions(nil, logSubscribeMessage, "testing:invalid", &ConsumerOptions{Overflow: "unknown"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, p.Len())
+}
+
+func TestRedisSubscribeNamed(t *testing.T) {
+	p := newTestingSubPool()
+	defer p.Close()
+
+	_, err := p.SubscribeNamed("unknown", "testing:named", false, nil)
+	assert.Equal(t, ErrSubscribeHandlerNotFound, err)
+	_, err = p.SubscribeNamed(SubscribeHandlerLog, "testing:named", false, &ConsumerOptions{Overflow: "unknown"})
+	assert.Error(t, err)
+
+	info, err := p.SubscribeNamed(SubscribeHandlerLog, "testing:named", false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "testing:named", info.Channel)
+	assert.Equal(t, SubscribeHandlerLog, info.Handler)
+	_, err = p.SubscribeNamed(SubscribeHandlerCacheDelete, "testing:named", false, nil)
+	assert.Equal(t, ErrSubscriptionExists, err)
+	_, err = p.SubscribeNamed(SubscribeHandlerLog, "testing:named", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, p.Len())
+
+	// 失败的订阅可以重新订阅
+	sub, _ := p.lookup("testing:named", false)
+	sub.setState(SubscriptionFailed, errors.New("testing"))
+	info, err = p.SubscribeNamed(SubscribeHandlerCacheDelete, "testing:named", false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, SubscribeHandlerCacheDelete, info.Handler)
+	assert.Equal(t, 2, p.Len())
+	assert.Error(t, sub.ctx.Err())
+
+	assert.Contains(t, SubscribeHandlers(), SubscribeHandlerCacheDelete)
+	assert.Panics(t, func() { RegisterSubscribeHandler(SubscribeHandlerLog, logSubscribeMessage) })
+}
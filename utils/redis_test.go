@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 
+	"github.com/frank-yf/go-web-example/utils/json"
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,3 +14,38 @@ func TestRedisPing(t *testing.T) {
 	res, bn := PingRedis(ctx)
 	assert.Truef(t, bn, "无法获取redis连接信息，ping返回信息：%s", res)
 }
+
+func TestNewRedisClient(t *testing.T) {
+	opts := DefaultRedisOptions()
+	client, err := newRedisClient(opts)
+	assert.Nil(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+	assert.Nil(t, client.Close())
+
+	opts.Mode = RedisModeCluster
+	client, err = newRedisClient(opts)
+	assert.Nil(t, err)
+	assert.IsType(t, &redis.ClusterClient{}, client)
+	assert.Nil(t, client.Close())
+
+	opts.Mode = RedisModeSentinel
+	_, err = newRedisClient(opts)
+	assert.NotNil(t, err)
+
+	opts.Mode = "unknown"
+	_, err = newRedisClient(opts)
+	assert.NotNil(t, err)
+}
+
+func TestRedisOptionsUnmarshalJSON(t *testing.T) {
+	var conf Config
+	err := json.Unmarshal([]byte(`{"redisInstances":{"cache":{"addrs":["cache:6379"],"db":0}}}`), &conf)
+	assert.Nil(t, err)
+
+	opts := conf.RedisInstances["cache"]
+	assert.Equal(t, []string{"cache:6379"}, opts.Addrs)
+	assert.Equal(t, 0, opts.DB)
+	// 未声明的项使用默认值
+	assert.Equal(t, RedisModeStandalone, opts.Mode)
+	assert.Equal(t, 20, opts.PoolSize)
+}
@@ -0,0 +1,492 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	// JobTriggerSchedule 按计划执行
+	JobTriggerSchedule = "schedule"
+	// JobTriggerManual 通过 Trigger 立即执行
+	JobTriggerManual = "manual"
+
+	// jobLockPrefix 定时任务使用的分布式锁名称前缀
+	jobLockPrefix = "job:"
+	// jobPausedKeyPrefix 分布式定时任务暂停标记在redis中的键前缀，所有实例共享
+	jobPausedKeyPrefix = "job:paused:"
+	// jobClockSkew 任务完成后继续占用锁的时长上限，避免时钟偏差较大的其他实例在同一周期重复执行
+	jobClockSkew = 2 * time.Second
+	// jobReleaseTimeout 释放任务锁的最长等待时间
+	jobReleaseTimeout = 3 * time.Second
+)
+
+var (
+	// ErrJobExists 同名的定时任务已经存在
+	ErrJobExists = errors.New("job already exists")
+	// ErrJobNotFound 定时任务不存在
+	ErrJobNotFound = errors.New("job not found")
+
+	// cronParser 支持5位或6位（带秒）的 cron 表达式，以及 @every 1m、@hourly 等描述符
+	cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow |
+		cron.Descriptor)
+
+	scheduledJobs   = make(map[string]*ScheduledJob)
+	scheduledJobsMu sync.Mutex
+)
+
+// JobFunc 定时任务，ctx 在超时、失去任务锁或停止调度时结束
+type JobFunc func(ctx context.Context) error
+
+// JobOptions 定时任务配置，Cron 与 Interval 只能配置一个
+type JobOptions struct {
+	Name string `json:"name"`
+	// Cron cron 表达式，见 cronParser
+	Cron string `json:"cron"`
+	// Interval 固定的执行间隔，按整点对齐，所有实例的执行时间一致
+	Interval Duration `json:"interval"`
+	// Jitter 按计划执行前随机等待 [0, Jitter) 的时长，分散同一时刻触发的任务
+	Jitter Duration `json:"jitter"`
+	// Timeout 单次执行的时长，超时后结束任务的 ctx，为0时不限制
+	Timeout Duration `json:"timeout"`
+	// Local 为 true 时每个实例都会执行，否则通过分布式锁保证同一时刻只有一个实例执行
+	Local bool `json:"local"`
+	// LockTTL 任务锁的过期时间，执行期间自动续期
+	LockTTL Duration `json:"lockTtl"`
+	// History 保留的执行记录数
+	History int `json:"history"`
+}
+
+// complete 使用默认值补全未配置的项，并解析执行计划
+func (o *JobOptions) complete() (*JobOptions, cron.Schedule, error) {
+	if o == nil || o.Name == "" {
+		return nil, nil, errors.New("name of job is required")
+	}
+	opts := *o
+	var schedule cron.Schedule
+	switch {
+	case opts.Cron != "" && opts.Interval > 0:
+		return nil, nil, errors.New("only one of cron and interval can be set")
+	case opts.Cron != "":
+		s, err := cronParser.Parse(opts.Cron)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid cron expression '%s': %w", opts.Cron, err)
+		}
+		// 例如 0 0 30 2 * 可以解析但永远不会执行
+		if s.Next(time.Now()).IsZero() {
+			return nil, nil, fmt.Errorf("cron expression '%s' never matches", opts.Cron)
+		}
+		schedule = s
+	case opts.Interval > 0:
+		schedule = intervalSchedule(opts.Interval)
+	default:
+		return nil, nil, errors.New("one of cron and interval is required")
+	}
+	if opts.Jitter < 0 {
+		opts.Jitter = 0
+	}
+	if opts.Timeout < 0 {
+		opts.Timeout = 0
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = Duration(30 * time.Second)
+	}
+	if opts.History <= 0 {
+		opts.History = 20
+	}
+	return &opts, schedule, nil
+}
+
+// intervalSchedule 固定间隔的执行计划，按整点对齐
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	d := time.Duration(s)
+	return t.Truncate(d).Add(d)
+}
+
+// JobRun 定时任务的执行记录
+type JobRun struct {
+	Trigger   string    `json:"trigger"`
+	Instance  string    `json:"instance"`
+	StartedAt time.Time `json:"startedAt"`
+	Duration  Duration  `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// JobInfo 定时任务的运行状态
+type JobInfo struct {
+	Name string `json:"name"`
+	// Schedule cron 表达式或固定间隔
+	Schedule string     `json:"schedule"`
+	Local    bool       `json:"local"`
+	Paused   bool       `json:"paused"`
+	Running  bool       `json:"running"`
+	NextRun  *time.Time `json:"nextRun,omitempty"`
+	// Runs、Failures 当前实例的执行次数与失败次数，包含 panic 与超时
+	Runs     uint64 `json:"runs"`
+	Failures uint64 `json:"failures"`
+	// Skipped 因为其他实例正在执行而跳过的次数
+	Skipped uint64  `json:"skipped"`
+	LastRun *JobRun `json:"lastRun,omitempty"`
+}
+
+// ScheduledJob 定时任务
+type ScheduledJob struct {
+	name     string
+	opts     *JobOptions
+	schedule cron.Schedule
+	fn       JobFunc
+
+	// trigger 立即执行的信号，已有等待执行的信号时忽略
+	trigger chan struct{}
+	// paused 只用于 Local 任务，分布式任务的暂停标记保存在redis中
+	paused  int32
+	running int32
+
+	mu       sync.Mutex
+	next     time.Time
+	history  []*JobRun
+	runs     uint64
+	failures uint64
+	skipped  uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// ScheduleJob 注册并启动定时任务，同名任务已经存在时返回 ErrJobExists
+func ScheduleJob(opts *JobOptions, fn JobFunc) (*ScheduledJob, error) {
+	opts, schedule, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	scheduledJobsMu.Lock()
+	defer scheduledJobsMu.Unlock()
+	if _, ok := scheduledJobs[opts.Name]; ok {
+		return nil, ErrJobExists
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &ScheduledJob{
+		name:     opts.Name,
+		opts:     opts,
+		schedule: schedule,
+		fn:       fn,
+		trigger:  make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	scheduledJobs[opts.Name] = j
+	Go(j.loop)
+	GetLogger().Info("job scheduled", zap.String("name", opts.Name), zap.String("schedule", j.scheduleString()))
+	return j, nil
+}
+
+// GetScheduledJob 获取定时任务，不存在时返回 ErrJobNotFound
+func GetScheduledJob(name string) (*ScheduledJob, error) {
+	scheduledJobsMu.Lock()
+	defer scheduledJobsMu.Unlock()
+	j, ok := scheduledJobs[name]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return j, nil
+}
+
+// ScheduledJobs 所有定时任务的运行状态，按名称排序
+func ScheduledJobs(ctx context.Context) []*JobInfo {
+	infos := make([]*JobInfo, 0)
+	for _, j := range listScheduledJobs() {
+		infos = append(infos, j.Info(ctx))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// StopScheduledJobs 停止所有定时任务，等待正在执行的任务结束或 ctx 结束
+func StopScheduledJobs(ctx context.Context) {
+	for _, j := range listScheduledJobs() {
+		j.Stop(ctx)
+	}
+}
+
+func listScheduledJobs() []*ScheduledJob {
+	scheduledJobsMu.Lock()
+	defer scheduledJobsMu.Unlock()
+	jobs := make([]*ScheduledJob, 0, len(scheduledJobs))
+	for _, j := range scheduledJobs {
+		jobs = append(jobs, j)
+	}
+	return jobs
+}
+
+// Trigger 立即执行一次，暂停的任务同样会执行；任务正在执行时在执行完成后再执行一次
+func (j *ScheduledJob) Trigger() {
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Pause 暂停按计划执行，分布式任务在所有实例上暂停
+func (j *ScheduledJob) Pause(ctx context.Context) error {
+	if j.opts.Local {
+		atomic.StoreInt32(&j.paused, 1)
+		return nil
+	}
+	return GetRedisCli().Set(ctx, jobPausedKeyPrefix+j.name, InstanceID(), 0).Err()
+}
+
+// Resume 恢复按计划执行
+func (j *ScheduledJob) Resume(ctx context.Context) error {
+	if j.opts.Local {
+		atomic.StoreInt32(&j.paused, 0)
+		return nil
+	}
+	return GetRedisCli().Del(ctx, jobPausedKeyPrefix+j.name).Err()
+}
+
+// Paused 是否已暂停
+func (j *ScheduledJob) Paused(ctx context.Context) (bool, error) {
+	if j.opts.Local {
+		return atomic.LoadInt32(&j.paused) == 1, nil
+	}
+	n, err := GetRedisCli().Exists(ctx, jobPausedKeyPrefix+j.name).Result()
+	return n > 0, err
+}
+
+// Stop 停止调度并从任务列表中移除，等待正在执行的任务结束或 ctx 结束
+func (j *ScheduledJob) Stop(ctx context.Context) {
+	j.cancel()
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		GetLogger().Warn("stop job timeout", zap.String("name", j.name))
+	}
+
+	scheduledJobsMu.Lock()
+	if scheduledJobs[j.name] == j {
+		delete(scheduledJobs, j.name)
+	}
+	scheduledJobsMu.Unlock()
+}
+
+// Info 任务的运行状态
+func (j *ScheduledJob) Info(ctx context.Context) *JobInfo {
+	paused, err := j.Paused(ctx)
+	if err != nil {
+		GetLogger().Warn("query job paused error", zap.String("name", j.name), zap.Error(err))
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := &JobInfo{
+		Name:     j.name,
+		Schedule: j.scheduleString(),
+		Local:    j.opts.Local,
+		Paused:   paused,
+		Running:  atomic.LoadInt32(&j.running) == 1,
+		Runs:     j.runs,
+		Failures: j.failures,
+		Skipped:  j.skipped,
+	}
+	if !j.next.IsZero() {
+		next := j.next
+		info.NextRun = &next
+	}
+	if n := len(j.history); n > 0 {
+		info.LastRun = j.history[n-1]
+	}
+	return info
+}
+
+// History 最近的执行记录，按时间倒序
+func (j *ScheduledJob) History() []*JobRun {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	runs := make([]*JobRun, 0, len(j.history))
+	for i := len(j.history) - 1; i >= 0; i-- {
+		runs = append(runs, j.history[i])
+	}
+	return runs
+}
+
+func (j *ScheduledJob) scheduleString() string {
+	if j.opts.Cron != "" {
+		return j.opts.Cron
+	}
+	return "@every " + j.opts.Interval.Std().String()
+}
+
+// loop 等待下一次计划执行时间或立即执行的信号
+// 没有下一次计划执行时间时不再按计划执行，只响应立即执行的信号
+func (j *ScheduledJob) loop() {
+	defer close(j.done)
+	for {
+		scheduledAt := j.schedule.Next(time.Now())
+		j.mu.Lock()
+		j.next = scheduledAt
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(scheduledAt))
+		// fire 为 nil 时永远不会触发
+		fire := timer.C
+		if scheduledAt.IsZero() {
+			timer.Stop()
+			fire = nil
+			GetLogger().Warn("job has no next schedule time",
+				zap.String("name", j.name),
+				zap.String("schedule", j.scheduleString()),
+			)
+		}
+		select {
+		case <-j.ctx.Done():
+			timer.Stop()
+			return
+		case <-j.trigger:
+			timer.Stop()
+			j.run(JobTriggerManual, time.Now())
+		case <-fire:
+			if paused, err := j.Paused(j.ctx); paused || err != nil {
+				if err != nil && j.ctx.Err() == nil {
+					GetLogger().Warn("skip job, query paused error", zap.String("name", j.name), zap.Error(err))
+				}
+				continue
+			}
+			if j.opts.Jitter > 0 && !sleepContext(j.ctx, time.Duration(rand.Int63n(int64(j.opts.Jitter)))) {
+				return
+			}
+			j.run(JobTriggerSchedule, scheduledAt)
+		}
+	}
+}
+
+// run 执行一次任务，分布式任务在获取任务锁后执行，锁被其他实例持有时跳过
+func (j *ScheduledJob) run(trigger string, scheduledAt time.Time) {
+	atomic.StoreInt32(&j.running, 1)
+	defer atomic.StoreInt32(&j.running, 0)
+
+	ctx, cancel := context.WithCancel(j.ctx)
+	defer cancel()
+	if j.opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, j.opts.Timeout.Std())
+		defer cancel()
+	}
+
+	start := time.Now()
+	if !j.opts.Local {
+		lock, err := TryLock(ctx, jobLockPrefix+j.name, &LockOptions{TTL: j.opts.LockTTL, AutoRenew: true})
+		if err == ErrLockNotAcquired {
+			j.mu.Lock()
+			j.skipped++
+			j.mu.Unlock()
+			GetLogger().Debug("skip job running on other instance", zap.String("name", j.name))
+			return
+		}
+		if err != nil {
+			j.record(trigger, start, fmt.Errorf("acquire job lock: %w", err))
+			return
+		}
+		defer j.release(lock, j.holdUntil(trigger, scheduledAt))
+		// 失去任务锁时结束任务的 ctx
+		Go(func() {
+			select {
+			case <-lock.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		})
+	}
+	j.record(trigger, start, j.call(ctx))
+}
+
+// holdUntil 任务完成后继续占用锁的截止时间
+// 按计划执行时需要覆盖其他实例的随机等待，占用到计划执行时间之后 Jitter 加上 jobClockSkew 与执行周期一半中的较小值，
+// 最长不超过一个执行周期
+func (j *ScheduledJob) holdUntil(trigger string, scheduledAt time.Time) time.Time {
+	period := j.schedule.Next(scheduledAt).Sub(scheduledAt)
+	hold := jobClockSkew
+	if period/2 < hold {
+		hold = period / 2
+	}
+	if trigger == JobTriggerSchedule {
+		hold += j.opts.Jitter.Std()
+	}
+	if hold > period {
+		hold = period
+	}
+	return scheduledAt.Add(hold)
+}
+
+// release 在任务完成后继续占用锁到 until
+func (j *ScheduledJob) release(lock *Lock, until time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobReleaseTimeout)
+	defer cancel()
+	if err := lock.releaseAfter(ctx, time.Until(until)); err != nil {
+		GetLogger().Warn("release job lock error", zap.String("name", j.name), zap.Error(err))
+	}
+}
+
+// call 执行任务，将 panic 转换为包含调用栈的错误
+func (j *ScheduledJob) call(ctx context.Context) (err error) {
+	defer func() {
+		if res := recover(); res != nil {
+			err = fmt.Errorf("panic: %v\n%s", res, debug.Stack())
+		}
+	}()
+	if err = j.fn(ctx); err == nil && ctx.Err() == context.DeadlineExceeded {
+		err = ctx.Err()
+	}
+	return
+}
+
+// record 保存执行记录，超过 History 时丢弃最早的记录
+func (j *ScheduledJob) record(trigger string, start time.Time, err error) {
+	run := &JobRun{
+		Trigger:   trigger,
+		Instance:  InstanceID(),
+		StartedAt: start,
+		Duration:  Duration(time.Since(start)),
+	}
+	if err != nil {
+		run.Error = err.Error()
+		GetLogger().Warn("job failed",
+			zap.String("name", j.name),
+			zap.String("trigger", trigger),
+			zap.Duration("elapsed", run.Duration.Std()),
+			zap.Error(err),
+		)
+	} else {
+		GetLogger().Info("job finished",
+			zap.String("name", j.name),
+			zap.String("trigger", trigger),
+			zap.Duration("elapsed", run.Duration.Std()),
+		)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.runs++
+	if err != nil {
+		j.failures++
+	}
+	j.history = append(j.history, run)
+	if len(j.history) > j.opts.History {
+		j.history = j.history[len(j.history)-j.opts.History:]
+	}
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobOptionsComplete(t *testing.T) {
+	_, _, err := (&JobOptions{Cron: "* * * * *"}).complete()
+	assert.NotNil(t, err)
+	_, _, err = (&JobOptions{Name: "testing"}).complete()
+	assert.NotNil(t, err)
+	_, _, err = (&JobOptions{Name: "testing", Cron: "* * * * *", Interval: Duration(time.Second)}).complete()
+	assert.NotNil(t, err)
+	_, _, err = (&JobOptions{Name: "testing", Cron: "invalid"}).complete()
+	assert.NotNil(t, err)
+
+	opts, schedule, err := (&JobOptions{Name: "testing", Cron: "0 */5 * * * *"}).complete()
+	assert.Nil(t, err)
+	assert.Equal(t, 20, opts.History)
+	assert.Equal(t, Duration(30*time.Second), opts.LockTTL)
+	now := time.Date(2021, 1, 1, 0, 3, 0, 0, time.UTC)
+	assert.Equal(t, now.Add(2*time.Minute), schedule.Next(now))
+
+	_, schedule, err = (&JobOptions{Name: "testing", Interval: Duration(time.Minute)}).complete()
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(time.Minute), schedule.Next(now.Add(10*time.Second)))
+
+	// 可以解析但永远不会执行的表达式
+	_, _, err = (&JobOptions{Name: "testing", Cron: "0 0 30 2 *"}).complete()
+	assert.NotNil(t, err)
+}
+
+func TestScheduledJobNeverMatches(t *testing.T) {
+	schedule, err := cronParser.Parse("0 0 30 2 *")
+	assert.Nil(t, err)
+	assert.True(t, schedule.Next(time.Now()).IsZero())
+
+	var calls int32
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &ScheduledJob{
+		name:     "testing:never",
+		opts:     &JobOptions{Name: "testing:never", Cron: "0 0 30 2 *", Local: true, History: 1},
+		schedule: schedule,
+		fn: func(context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		},
+		trigger: make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go j.loop()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	// 仍然可以立即执行
+	j.Trigger()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-j.done
+}
+
+func TestScheduledJobHoldUntil(t *testing.T) {
+	schedule, err := cronParser.Parse("@every 1m")
+	assert.Nil(t, err)
+	j := &ScheduledJob{opts: &JobOptions{Jitter: Duration(10 * time.Second)}, schedule: schedule}
+	scheduledAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 按计划执行时覆盖其他实例的随机等待
+	assert.Equal(t, scheduledAt.Add(12*time.Second), j.holdUntil(JobTriggerSchedule, scheduledAt))
+	assert.Equal(t, scheduledAt.Add(jobClockSkew), j.holdUntil(JobTriggerManual, scheduledAt))
+
+	// 最长不超过一个执行周期
+	j.opts.Jitter = Duration(5 * time.Minute)
+	assert.Equal(t, scheduledAt.Add(time.Minute), j.holdUntil(JobTriggerSchedule, scheduledAt))
+}
+
+func TestScheduledJob(t *testing.T) {
+	ctx := context.TODO()
+	var calls int32
+	job, err := ScheduleJob(&JobOptions{
+		Name:     "testing",
+		Interval: Duration(50 * time.Millisecond),
+		Local:    true,
+		History:  2,
+	}, func(ctx context.Context) error {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			panic("testing panic")
+		case 2:
+			return errors.New("testing error")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	_, err = ScheduleJob(&JobOptions{Name: "testing", Interval: Duration(time.Second)}, nil)
+	assert.Equal(t, ErrJobExists, err)
+
+	assert.Eventually(t, func() bool { return job.Info(ctx).Runs >= 3 }, time.Second, 10*time.Millisecond)
+	info := job.Info(ctx)
+	assert.Equal(t, uint64(2), info.Failures)
+	assert.Equal(t, "@every 50ms", info.Schedule)
+	assert.Len(t, job.History(), 2)
+
+	assert.Nil(t, job.Pause(ctx))
+	paused := job.Info(ctx).Runs
+	time.Sleep(120 * time.Millisecond)
+	assert.Equal(t, paused, job.Info(ctx).Runs)
+	assert.True(t, job.Info(ctx).Paused)
+
+	// 暂停的任务可以手动执行
+	job.Trigger()
+	assert.Eventually(t, func() bool { return job.Info(ctx).Runs == paused+1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, JobTriggerManual, job.History()[0].Trigger)
+	assert.Nil(t, job.Resume(ctx))
+
+	StopScheduledJobs(ctx)
+	_, err = GetScheduledJob("testing")
+	assert.Equal(t, ErrJobNotFound, err)
+}
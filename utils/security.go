@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/frank-yf/go-web-example/utils/json"
+)
+
+// SecurityOptions 安全相关响应头的配置
+// 字段为空值时不输出对应的响应头
+type SecurityOptions struct {
+	// HSTSMaxAge Strict-Transport-Security 的有效期
+	HSTSMaxAge Duration `json:"hstsMaxAge"`
+	// HSTSIncludeSubdomains HSTS 策略是否同时作用于子域名
+	HSTSIncludeSubdomains bool `json:"hstsIncludeSubdomains"`
+	// FrameOptions X-Frame-Options，可选 DENY、SAMEORIGIN
+	FrameOptions string `json:"frameOptions"`
+	// ReferrerPolicy Referrer-Policy
+	ReferrerPolicy string `json:"referrerPolicy"`
+	// ContentSecurityPolicy Content-Security-Policy
+	ContentSecurityPolicy string `json:"contentSecurityPolicy"`
+}
+
+// DefaultSecurityOptions 默认的安全响应头配置
+func DefaultSecurityOptions() *SecurityOptions {
+	return &SecurityOptions{
+		HSTSMaxAge:            Duration(365 * 24 * time.Hour),
+		HSTSIncludeSubdomains: true,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+	}
+}
+
+// UnmarshalJSON 在默认配置的基础上反序列化，未声明的项使用默认值，声明为空值时不输出对应的响应头
+func (o *SecurityOptions) UnmarshalJSON(data []byte) error {
+	type plain SecurityOptions
+	opts := (*plain)(DefaultSecurityOptions())
+	if err := json.Unmarshal(data, opts); err != nil {
+		return err
+	}
+	*o = SecurityOptions(*opts)
+	return nil
+}
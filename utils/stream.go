@@ -0,0 +1,494 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	// streamDeadLetterSuffix 默认的死信消息流名称后缀
+	streamDeadLetterSuffix = ":dead"
+	// streamCursorStart XAUTOCLAIM 的起始游标，返回该游标时表示已经扫描完所有待确认消息
+	streamCursorStart = "0-0"
+	// streamWriteTimeout 确认消息与写入死信消息流的超时时间，停止消费者时同样需要完成写入
+	streamWriteTimeout = 5 * time.Second
+)
+
+var (
+	// ErrStreamConsumerExists 同一个消息流与消费组已经存在消费者
+	ErrStreamConsumerExists = errors.New("stream consumer already exists")
+
+	streamConsumers   = make(map[string]*StreamConsumer)
+	streamConsumersMu sync.Mutex
+)
+
+// StreamHandler 消息流的消息处理函数，返回 nil 时确认消息，否则消息在 MinIdle 后被重新投递
+type StreamHandler func(ctx context.Context, msg redis.XMessage) error
+
+// StreamConsumerOptions 消息流消费者配置
+type StreamConsumerOptions struct {
+	// Stream、Group 消息流与消费组名称，消费组不存在时自动创建
+	Stream string `json:"stream"`
+	Group  string `json:"group"`
+	// Consumer 消费者名称，默认为 InstanceID
+	Consumer string `json:"consumer"`
+	// StartID 创建消费组时的起始消息ID，默认 $ 只消费之后的消息，0 表示从头消费
+	StartID string `json:"startId"`
+	// BatchSize 每次读取的最大消息数
+	BatchSize int64 `json:"batchSize"`
+	// Block 没有消息时阻塞等待的时长，停止消费者时需要等待正在进行的阻塞读取结束
+	Block Duration `json:"block"`
+	// MinIdle 待确认消息超过该时长未被确认时，认为原消费者已经失效并重新认领
+	MinIdle Duration `json:"minIdle"`
+	// ClaimInterval 认领失效消息的检查周期
+	ClaimInterval Duration `json:"claimInterval"`
+	// MaxRetries 消息的最大重试次数，投递次数超过 MaxRetries+1 后转入死信消息流
+	MaxRetries int64 `json:"maxRetries"`
+	// DeadLetterStream 死信消息流名称，默认为消息流名称加上 :dead 后缀
+	DeadLetterStream string `json:"deadLetterStream"`
+	// Timeout 单条消息的处理时长，超时后结束处理函数的 ctx，为0时不限制
+	Timeout Duration `json:"timeout"`
+}
+
+// complete 使用默认值补全未配置的项
+func (o *StreamConsumerOptions) complete() (*StreamConsumerOptions, error) {
+	if o == nil || o.Stream == "" || o.Group == "" {
+		return nil, errors.New("stream and group of stream consumer are required")
+	}
+	opts := *o
+	if opts.Consumer == "" {
+		opts.Consumer = InstanceID()
+	}
+	if opts.StartID == "" {
+		opts.StartID = "$"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 10
+	}
+	if opts.Block <= 0 {
+		opts.Block = Duration(2 * time.Second)
+	}
+	if opts.MinIdle <= 0 {
+		opts.MinIdle = Duration(time.Minute)
+	}
+	if opts.ClaimInterval <= 0 {
+		opts.ClaimInterval = Duration(30 * time.Second)
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.DeadLetterStream == "" {
+		opts.DeadLetterStream = opts.Stream + streamDeadLetterSuffix
+	}
+	return &opts, nil
+}
+
+// StreamConsumerStats 消费者的统计数据
+type StreamConsumerStats struct {
+	Stream           string `json:"stream"`
+	Group            string `json:"group"`
+	Consumer         string `json:"consumer"`
+	DeadLetterStream string `json:"deadLetterStream"`
+	// Delivered 交给处理函数的消息数
+	Delivered uint64 `json:"delivered"`
+	// Acked 处理成功并确认的消息数
+	Acked uint64 `json:"acked"`
+	// Failed 处理失败的消息数
+	Failed uint64 `json:"failed"`
+	// Claimed 从失效消费者认领的消息数
+	Claimed uint64 `json:"claimed"`
+	// DeadLettered 转入死信消息流的消息数
+	DeadLettered uint64 `json:"deadLettered"`
+	// LastError 最近一次读取或认领消息的错误
+	LastError string `json:"lastError,omitempty"`
+}
+
+// StreamConsumer 基于消费组的消息流消费者
+// 新消息通过 XREADGROUP 读取，处理成功后确认；未确认的消息超过 MinIdle 后通过 XAUTOCLAIM 重新认领并处理，
+// 投递次数超过重试上限的消息转入死信消息流
+type StreamConsumer struct {
+	opts    *StreamConsumerOptions
+	handler StreamHandler
+	// ctx 停止读取新消息，handlerCtx 结束正在处理的消息
+	ctx           context.Context
+	cancel        context.CancelFunc
+	handlerCtx    context.Context
+	handlerCancel context.CancelFunc
+	done          chan struct{}
+
+	// groupReady 消费组是否已经创建
+	groupReady bool
+
+	delivered    uint64
+	acked        uint64
+	failed       uint64
+	claimed      uint64
+	deadLettered uint64
+	lastError    atomic.Value
+}
+
+// StartStreamConsumer 创建并启动消息流消费者，同一个消息流与消费组在进程内只能有一个消费者
+func StartStreamConsumer(opts *StreamConsumerOptions, handler StreamHandler) (*StreamConsumer, error) {
+	opts, err := opts.complete()
+	if err != nil {
+		return nil, err
+	}
+
+	streamConsumersMu.Lock()
+	defer streamConsumersMu.Unlock()
+
+	key := streamConsumerKey(opts.Stream, opts.Group)
+	if _, ok := streamConsumers[key]; ok {
+		return nil, ErrStreamConsumerExists
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	handlerCtx, handlerCancel := context.WithCancel(context.Background())
+	c := &StreamConsumer{
+		opts:          opts,
+		handler:       handler,
+		ctx:           ctx,
+		cancel:        cancel,
+		handlerCtx:    handlerCtx,
+		handlerCancel: handlerCancel,
+		done:          make(chan struct{}),
+	}
+	streamConsumers[key] = c
+	Go(c.run)
+	GetLogger().Info("stream consumer started",
+		zap.String("stream", opts.Stream),
+		zap.String("group", opts.Group),
+		zap.String("consumer", opts.Consumer),
+	)
+	return c, nil
+}
+
+// StreamConsumers 所有消费者的统计数据，按消息流与消费组排序
+func StreamConsumers() []*StreamConsumerStats {
+	streamConsumersMu.Lock()
+	keys := make([]string, 0, len(streamConsumers))
+	for key := range streamConsumers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	stats := make([]*StreamConsumerStats, 0, len(keys))
+	for _, key := range keys {
+		stats = append(stats, streamConsumers[key].Stats())
+	}
+	streamConsumersMu.Unlock()
+	return stats
+}
+
+// StopStreamConsumers 停止所有消费者，等待正在处理的消息完成或 ctx 结束
+func StopStreamConsumers(ctx context.Context) {
+	streamConsumersMu.Lock()
+	consumers := make([]*StreamConsumer, 0, len(streamConsumers))
+	for _, c := range streamConsumers {
+		consumers = append(consumers, c)
+	}
+	streamConsumersMu.Unlock()
+
+	for _, c := range consumers {
+		c.Stop(ctx)
+	}
+}
+
+// PublishStream 向消息流发送消息，maxLen 大于0时近似地裁剪消息流的长度
+func PublishStream(ctx context.Context, stream string, values map[string]interface{}, maxLen int64) (string, error) {
+	return streamRedisCli().XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: true,
+		Values: values,
+	}).Result()
+}
+
+// Stop 停止读取新消息并等待已读取的消息处理完成，ctx 结束时取消正在处理的消息并直接返回
+// 被取消的消息不会确认，在 MinIdle 后被重新投递
+func (c *StreamConsumer) Stop(ctx context.Context) {
+	c.cancel()
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		GetLogger().Warn("drain stream consumer timeout, cancel running handlers",
+			zap.String("stream", c.opts.Stream),
+			zap.String("group", c.opts.Group),
+		)
+	}
+	c.handlerCancel()
+
+	streamConsumersMu.Lock()
+	key := streamConsumerKey(c.opts.Stream, c.opts.Group)
+	if streamConsumers[key] == c {
+		delete(streamConsumers, key)
+	}
+	streamConsumersMu.Unlock()
+	GetLogger().Info("stream consumer stopped",
+		zap.String("stream", c.opts.Stream),
+		zap.String("group", c.opts.Group),
+	)
+}
+
+// Stats 消费者的统计数据
+func (c *StreamConsumer) Stats() *StreamConsumerStats {
+	stats := &StreamConsumerStats{
+		Stream:           c.opts.Stream,
+		Group:            c.opts.Group,
+		Consumer:         c.opts.Consumer,
+		DeadLetterStream: c.opts.DeadLetterStream,
+		Delivered:        atomic.LoadUint64(&c.delivered),
+		Acked:            atomic.LoadUint64(&c.acked),
+		Failed:           atomic.LoadUint64(&c.failed),
+		Claimed:          atomic.LoadUint64(&c.claimed),
+		DeadLettered:     atomic.LoadUint64(&c.deadLettered),
+	}
+	if err, ok := c.lastError.Load().(string); ok {
+		stats.LastError = err
+	}
+	return stats
+}
+
+// run 循环认领失效消息与读取新消息，出错时按退避策略重试
+func (c *StreamConsumer) run() {
+	defer close(c.done)
+	backoff := Backoff{Initial: 500 * time.Millisecond, Max: 30 * time.Second}
+
+	var lastClaim time.Time
+	for attempt := 0; c.ctx.Err() == nil; {
+		err := c.ensureGroup()
+		if err == nil && time.Since(lastClaim) >= c.opts.ClaimInterval.Std() {
+			err = c.reclaim()
+			lastClaim = time.Now()
+		}
+		if err == nil {
+			err = c.read()
+		}
+		if err == nil || c.ctx.Err() != nil {
+			attempt = 0
+			continue
+		}
+
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			// 消费组被删除，下次循环时重新创建
+			c.groupReady = false
+		}
+		c.lastError.Store(err.Error())
+		wait := backoff.Duration(attempt)
+		GetLogger().Warn("consume stream error",
+			zap.String("stream", c.opts.Stream),
+			zap.String("group", c.opts.Group),
+			zap.Duration("backoff", wait),
+			zap.Error(err),
+		)
+		if !sleepContext(c.ctx, wait) {
+			return
+		}
+		attempt++
+	}
+}
+
+// ensureGroup 创建消费组，消费组已存在时忽略
+func (c *StreamConsumer) ensureGroup() error {
+	if c.groupReady {
+		return nil
+	}
+	err := streamRedisCli().XGroupCreateMkStream(c.ctx, c.opts.Stream, c.opts.Group, c.opts.StartID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	c.groupReady = true
+	return nil
+}
+
+// read 读取并处理新消息
+func (c *StreamConsumer) read() error {
+	streams, err := streamRedisCli().XReadGroup(c.ctx, &redis.XReadGroupArgs{
+		Group:    c.opts.Group,
+		Consumer: c.opts.Consumer,
+		Streams:  []string{c.opts.Stream, ">"},
+		Count:    c.opts.BatchSize,
+		Block:    c.opts.Block.Std(),
+	}).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			if c.handlerCtx.Err() != nil {
+				return nil
+			}
+			c.handle(msg, 1)
+		}
+	}
+	return nil
+}
+
+// reclaim 认领超过 MinIdle 未确认的消息，投递次数超过重试上限的消息转入死信消息流
+func (c *StreamConsumer) reclaim() error {
+	for start := streamCursorStart; c.ctx.Err() == nil; {
+		next, msgs, err := streamAutoClaim(c.ctx, streamRedisCli(), &redis.XAutoClaimArgs{
+			Stream:   c.opts.Stream,
+			Group:    c.opts.Group,
+			MinIdle:  c.opts.MinIdle.Std(),
+			Start:    start,
+			Count:    c.opts.BatchSize,
+			Consumer: c.opts.Consumer,
+		})
+		if err != nil {
+			return err
+		}
+		if len(msgs) > 0 {
+			deliveries, err := c.deliveries(msgs)
+			if err != nil {
+				return err
+			}
+			atomic.AddUint64(&c.claimed, uint64(len(msgs)))
+			for _, msg := range msgs {
+				if c.handlerCtx.Err() != nil {
+					return nil
+				}
+				if n := deliveries[msg.ID]; n > c.opts.MaxRetries+1 {
+					c.deadLetter(msg, n, nil)
+				} else {
+					c.handle(msg, n)
+				}
+			}
+		}
+		if next == streamCursorStart || next == "" {
+			return nil
+		}
+		start = next
+	}
+	return nil
+}
+
+// deliveries 查询认领到的消息的投递次数
+// 待确认列表中认领到的消息之间可能还有其他消息，因此逐条查询
+func (c *StreamConsumer) deliveries(msgs []redis.XMessage) (map[string]int64, error) {
+	cmds, err := streamRedisCli().Pipelined(c.ctx, func(pipe redis.Pipeliner) error {
+		for _, msg := range msgs {
+			pipe.XPendingExt(c.ctx, &redis.XPendingExtArgs{
+				Stream:   c.opts.Stream,
+				Group:    c.opts.Group,
+				Start:    msg.ID,
+				End:      msg.ID,
+				Count:    1,
+				Consumer: c.opts.Consumer,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make(map[string]int64, len(msgs))
+	for _, cmd := range cmds {
+		for _, p := range cmd.(*redis.XPendingExtCmd).Val() {
+			deliveries[p.ID] = p.RetryCount
+		}
+	}
+	return deliveries, nil
+}
+
+// handle 处理消息，成功时确认消息；失败且投递次数超过重试上限时转入死信消息流
+// 停止消费者时被取消的消息不计入重试，保留在待确认列表中等待重新投递
+func (c *StreamConsumer) handle(msg redis.XMessage, deliveries int64) {
+	atomic.AddUint64(&c.delivered, 1)
+	err := c.call(msg)
+	if err != nil && c.handlerCtx.Err() != nil {
+		GetLogger().Warn("stream message canceled by stopping consumer",
+			zap.String("stream", c.opts.Stream),
+			zap.String("group", c.opts.Group),
+			zap.String("id", msg.ID),
+		)
+		return
+	}
+	if err != nil {
+		atomic.AddUint64(&c.failed, 1)
+		GetLogger().Warn("handle stream message error",
+			zap.String("stream", c.opts.Stream),
+			zap.String("group", c.opts.Group),
+			zap.String("id", msg.ID),
+			zap.Int64("deliveries", deliveries),
+			zap.Error(err),
+		)
+		if deliveries > c.opts.MaxRetries {
+			c.deadLetter(msg, deliveries, err)
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), streamWriteTimeout)
+	defer cancel()
+	if err = streamRedisCli().XAck(ctx, c.opts.Stream, c.opts.Group, msg.ID).Err(); err != nil {
+		GetLogger().Warn("ack stream message error", zap.String("id", msg.ID), zap.Error(err))
+		return
+	}
+	atomic.AddUint64(&c.acked, 1)
+}
+
+// call 调用处理函数，将 panic 转换为包含调用栈的错误
+func (c *StreamConsumer) call(msg redis.XMessage) (err error) {
+	ctx := c.handlerCtx
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout.Std())
+		defer cancel()
+	}
+	defer func() {
+		if res := recover(); res != nil {
+			err = fmt.Errorf("panic: %v\n%s", res, debug.Stack())
+		}
+	}()
+	return c.handler(ctx, msg)
+}
+
+// deadLetter 将消息转入死信消息流并确认原消息，死信消息额外记录来源与失败原因
+func (c *StreamConsumer) deadLetter(msg redis.XMessage, deliveries int64, cause error) {
+	values := make(map[string]interface{}, len(msg.Values)+5)
+	for k, v := range msg.Values {
+		values[k] = v
+	}
+	values["_stream"] = c.opts.Stream
+	values["_group"] = c.opts.Group
+	values["_id"] = msg.ID
+	values["_deliveries"] = deliveries
+	if cause != nil {
+		values["_error"] = cause.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamWriteTimeout)
+	defer cancel()
+	cli := streamRedisCli()
+	if err := cli.XAdd(ctx, &redis.XAddArgs{Stream: c.opts.DeadLetterStream, Values: values}).Err(); err != nil {
+		GetLogger().Error("add dead letter error", zap.String("id", msg.ID), zap.Error(err))
+		return
+	}
+	if err := cli.XAck(ctx, c.opts.Stream, c.opts.Group, msg.ID).Err(); err != nil {
+		GetLogger().Error("ack dead letter error", zap.String("id", msg.ID), zap.Error(err))
+		return
+	}
+	atomic.AddUint64(&c.deadLettered, 1)
+	GetLogger().Warn("stream message moved to dead letter",
+		zap.String("stream", c.opts.Stream),
+		zap.String("group", c.opts.Group),
+		zap.String("id", msg.ID),
+		zap.String("deadLetterStream", c.opts.DeadLetterStream),
+		zap.Int64("deliveries", deliveries),
+	)
+}
+
+func streamConsumerKey(stream, group string) string {
+	return stream + "/" + group
+}
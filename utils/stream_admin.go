@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// streamLagScanLimit 计算消费组积压数时最多扫描的消息数
+const streamLagScanLimit = 10000
+
+var (
+	// ErrStreamNotFound 消息流不存在
+	ErrStreamNotFound = errors.New("stream not found")
+	// ErrStreamGroupNotFound 消费组不存在
+	ErrStreamGroupNotFound = errors.New("stream group not found")
+)
+
+// StreamGroupInfo 消费组信息
+type StreamGroupInfo struct {
+	Name            string `json:"name"`
+	Consumers       int64  `json:"consumers"`
+	Pending         int64  `json:"pending"`
+	LastDeliveredID string `json:"lastDeliveredId"`
+	// Lag 尚未投递给消费组的消息数，redis 7 以下的版本通过扫描消息流计算，最多为 streamLagScanLimit
+	Lag int64 `json:"lag"`
+}
+
+// StreamPendingInfo 消费组的待确认消息
+type StreamPendingInfo struct {
+	Count  int64  `json:"count"`
+	Lower  string `json:"lower,omitempty"`
+	Higher string `json:"higher,omitempty"`
+	// Consumers 每个消费者的待确认消息数
+	Consumers map[string]int64 `json:"consumers"`
+	// Entries 最早的待确认消息
+	Entries []*StreamPendingEntry `json:"entries"`
+}
+
+// StreamPendingEntry 待确认消息
+type StreamPendingEntry struct {
+	ID         string   `json:"id"`
+	Consumer   string   `json:"consumer"`
+	Idle       Duration `json:"idle"`
+	Deliveries int64    `json:"deliveries"`
+}
+
+// StreamGroups 查看消息流的所有消费组
+// go-redis 的 XInfoGroups 只能解析 redis 7 以下版本的返回值，这里直接执行命令并解析
+func StreamGroups(ctx context.Context, stream string) ([]*StreamGroupInfo, error) {
+	cli := streamRedisCli()
+	reply, err := streamReplySlice(cli.Do(ctx, "xinfo", "groups", stream))
+	if err != nil {
+		return nil, streamError(err)
+	}
+
+	groups := make([]*StreamGroupInfo, 0, len(reply))
+	for _, item := range reply {
+		fields, err := streamReplyFields(item)
+		if err != nil {
+			return nil, err
+		}
+		group := &StreamGroupInfo{
+			Name:            fmt.Sprint(fields["name"]),
+			Consumers:       streamReplyInt(fields["consumers"]),
+			Pending:         streamReplyInt(fields["pending"]),
+			LastDeliveredID: fmt.Sprint(fields["last-delivered-id"]),
+		}
+		if lag, ok := fields["lag"].(int64); ok {
+			group.Lag = lag
+		} else if group.Lag, err = streamLag(ctx, cli, stream, group.LastDeliveredID); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// StreamPending 查看消费组的待确认消息，limit 为返回的待确认消息明细数量
+func StreamPending(ctx context.Context, stream, group string, limit int64) (*StreamPendingInfo, error) {
+	cli := streamRedisCli()
+	summary, err := cli.XPending(ctx, stream, group).Result()
+	if err != nil {
+		return nil, streamError(err)
+	}
+	info := &StreamPendingInfo{
+		Count:     summary.Count,
+		Lower:     summary.Lower,
+		Higher:    summary.Higher,
+		Consumers: summary.Consumers,
+		Entries:   make([]*StreamPendingEntry, 0),
+	}
+	if info.Consumers == nil {
+		info.Consumers = make(map[string]int64)
+	}
+	if summary.Count == 0 || limit <= 0 {
+		return info, nil
+	}
+
+	entries, err := cli.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Start:  "-",
+		End:    "+",
+		Count:  limit,
+	}).Result()
+	if err != nil {
+		return nil, streamError(err)
+	}
+	for _, e := range entries {
+		info.Entries = append(info.Entries, &StreamPendingEntry{
+			ID:         e.ID,
+			Consumer:   e.Consumer,
+			Idle:       Duration(e.Idle),
+			Deliveries: e.RetryCount,
+		})
+	}
+	return info, nil
+}
+
+// streamAutoClaim 执行 XAUTOCLAIM，返回下一次认领的游标与认领到的消息
+// go-redis 的 XAutoClaim 只能解析 redis 6.2 的返回值，这里直接执行命令并解析；已经被删除的消息会被忽略
+func streamAutoClaim(ctx context.Context, cli redis.UniversalClient, a *redis.XAutoClaimArgs) (
+	next string, msgs []redis.XMessage, err error) {
+	reply, err := streamReplySlice(cli.Do(ctx, "xautoclaim", a.Stream, a.Group, a.Consumer,
+		int64(a.MinIdle/time.Millisecond), a.Start, "count", a.Count))
+	if err != nil {
+		return
+	}
+	return parseStreamAutoClaim(reply)
+}
+
+func parseStreamAutoClaim(reply []interface{}) (next string, msgs []redis.XMessage, err error) {
+	if len(reply) < 2 {
+		return "", nil, fmt.Errorf("unexpected XAUTOCLAIM reply: %v", reply)
+	}
+	next = fmt.Sprint(reply[0])
+	entries, _ := reply[1].([]interface{})
+	for _, entry := range entries {
+		// redis 6.2 中已经被删除的消息返回空值
+		item, ok := entry.([]interface{})
+		if !ok || len(item) != 2 {
+			continue
+		}
+		kvs, ok := item[1].([]interface{})
+		if !ok {
+			continue
+		}
+		values := make(map[string]interface{}, len(kvs)/2)
+		for i := 0; i+1 < len(kvs); i += 2 {
+			values[fmt.Sprint(kvs[i])] = kvs[i+1]
+		}
+		msgs = append(msgs, redis.XMessage{ID: fmt.Sprint(item[0]), Values: values})
+	}
+	return
+}
+
+// streamLag 扫描消息流计算 lastID 之后的消息数，最多为 streamLagScanLimit
+func streamLag(ctx context.Context, cli redis.UniversalClient, stream, lastID string) (int64, error) {
+	msgs, err := cli.XRangeN(ctx, stream, lastID, "+", streamLagScanLimit+1).Result()
+	if err != nil {
+		return 0, streamError(err)
+	}
+	lag := int64(len(msgs))
+	if lag > 0 && msgs[0].ID == lastID {
+		lag--
+	}
+	if lag > streamLagScanLimit {
+		lag = streamLagScanLimit
+	}
+	return lag, nil
+}
+
+// streamReplySlice 获取数组类型的命令返回值
+func streamReplySlice(cmd *redis.Cmd) ([]interface{}, error) {
+	v, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+	reply, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s reply: %v", cmd.Name(), v)
+	}
+	return reply, nil
+}
+
+// streamReplyFields 将键值交替的数组转换为 map
+func streamReplyFields(item interface{}) (map[string]interface{}, error) {
+	kvs, ok := item.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected stream reply: %v", item)
+	}
+	fields := make(map[string]interface{}, len(kvs)/2)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		fields[fmt.Sprint(kvs[i])] = kvs[i+1]
+	}
+	return fields, nil
+}
+
+func streamReplyInt(v interface{}) int64 {
+	i, _ := v.(int64)
+	return i
+}
+
+// streamError 将消息流或消费组不存在的错误转换为 ErrStreamNotFound、ErrStreamGroupNotFound
+func streamError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case strings.HasPrefix(err.Error(), "NOGROUP"):
+		return ErrStreamGroupNotFound
+	case strings.Contains(err.Error(), "no such key"):
+		return ErrStreamNotFound
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamConsumerOptionsComplete(t *testing.T) {
+	_, err := (&StreamConsumerOptions{Stream: "testing"}).complete()
+	assert.NotNil(t, err)
+
+	opts, err := (&StreamConsumerOptions{Stream: "testing", Group: "g"}).complete()
+	assert.Nil(t, err)
+	assert.Equal(t, InstanceID(), opts.Consumer)
+	assert.Equal(t, "$", opts.StartID)
+	assert.Equal(t, "testing:dead", opts.DeadLetterStream)
+}
+
+func TestParseStreamAutoClaim(t *testing.T) {
+	next, msgs, err := parseStreamAutoClaim([]interface{}{
+		"1-1",
+		[]interface{}{
+			[]interface{}{"1-0", []interface{}{"k", "v"}},
+			nil,
+		},
+		// redis 7 额外返回已经被删除的消息ID
+		[]interface{}{"0-9"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "1-1", next)
+	assert.Equal(t, []redis.XMessage{{ID: "1-0", Values: map[string]interface{}{"k": "v"}}}, msgs)
+
+	_, _, err = parseStreamAutoClaim([]interface{}{"0-0"})
+	assert.NotNil(t, err)
+}
+
+func TestStreamError(t *testing.T) {
+	assert.Equal(t, ErrStreamGroupNotFound, streamError(errors.New("NOGROUP No such key 's' or consumer group 'g'")))
+	assert.Equal(t, ErrStreamNotFound, streamError(errors.New("ERR no such key")))
+	other := errors.New("other")
+	assert.Equal(t, other, streamError(other))
+}
+
+func TestStreamConsumerStopDrain(t *testing.T) {
+	ctx := context.TODO()
+	if _, ok := PingRedis(ctx); !ok {
+		t.Skip("redis unavailable")
+	}
+	stream := "testing:stream:" + NewRequestID()
+	defer streamRedisCli().Del(ctx, stream)
+
+	started := make(chan struct{})
+	c, err := StartStreamConsumer(&StreamConsumerOptions{
+		Stream:  stream,
+		Group:   "testing",
+		StartID: "0",
+		Block:   Duration(100 * time.Millisecond),
+	}, func(ctx context.Context, msg redis.XMessage) error {
+		close(started)
+		// 停止消费者不应该结束正在处理的消息
+		select {
+		case <-time.After(200 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	assert.Nil(t, err)
+
+	_, err = PublishStream(ctx, stream, map[string]interface{}{"k": "v"}, 0)
+	assert.Nil(t, err)
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("message not delivered")
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	c.Stop(stopCtx)
+	assert.Equal(t, uint64(1), c.Stats().Acked)
+	pending, err := streamRedisCli().XPending(ctx, stream, "testing").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+}
+
+func TestStreamConsumerRetryDeadLetter(t *testing.T) {
+	ctx := context.TODO()
+	if _, ok := PingRedis(ctx); !ok {
+		t.Skip("redis unavailable")
+	}
+	stream := "testing:stream:" + NewRequestID()
+	defer streamRedisCli().Del(ctx, stream, stream+streamDeadLetterSuffix)
+
+	var calls int32
+	c, err := StartStreamConsumer(&StreamConsumerOptions{
+		Stream:        stream,
+		Group:         "testing",
+		StartID:       "0",
+		Block:         Duration(100 * time.Millisecond),
+		MinIdle:       Duration(100 * time.Millisecond),
+		ClaimInterval: Duration(100 * time.Millisecond),
+		MaxRetries:    1,
+	}, func(ctx context.Context, msg redis.XMessage) error {
+		if msg.Values["k"] == "ok" {
+			return nil
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return errors.New("testing")
+		}
+		panic("boom")
+	})
+	assert.Nil(t, err)
+	defer c.Stop(ctx)
+
+	_, err = PublishStream(ctx, stream, map[string]interface{}{"k": "ok"}, 0)
+	assert.Nil(t, err)
+	badID, err := PublishStream(ctx, stream, map[string]interface{}{"k": "bad"}, 0)
+	assert.Nil(t, err)
+
+	// 第一次失败后由认领重试，第二次失败超过重试上限转入死信消息流
+	assert.Eventually(t, func() bool {
+		return c.Stats().DeadLettered == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.Acked)
+	assert.Equal(t, uint64(2), stats.Failed)
+	assert.True(t, stats.Claimed >= 1)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	dead, err := streamRedisCli().XRange(ctx, stream+streamDeadLetterSuffix, "-", "+").Result()
+	assert.Nil(t, err)
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, "bad", dead[0].Values["k"])
+		assert.Equal(t, badID, dead[0].Values["_id"])
+		assert.Contains(t, dead[0].Values["_error"], "panic: boom")
+	}
+	pending, err := streamRedisCli().XPending(ctx, stream, "testing").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+}
+
+func TestStreamConsumerDeliveries(t *testing.T) {
+	ctx := context.TODO()
+	if _, ok := PingRedis(ctx); !ok {
+		t.Skip("redis unavailable")
+	}
+	stream := "testing:stream:" + NewRequestID()
+	defer streamRedisCli().Del(ctx, stream)
+
+	opts, err := (&StreamConsumerOptions{Stream: stream, Group: "testing", StartID: "0"}).complete()
+	assert.Nil(t, err)
+	c := &StreamConsumer{opts: opts, ctx: ctx}
+	assert.Nil(t, c.ensureGroup())
+	for i := 0; i < 3; i++ {
+		_, err = PublishStream(ctx, stream, map[string]interface{}{"i": i}, 0)
+		assert.Nil(t, err)
+	}
+	streams, err := streamRedisCli().XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    opts.Group,
+		Consumer: opts.Consumer,
+		Streams:  []string{stream, ">"},
+	}).Result()
+	assert.Nil(t, err)
+	msgs := streams[0].Messages
+	assert.Len(t, msgs, 3)
+
+	// 待确认列表中认领到的消息之间还有其他消息
+	claimed := []redis.XMessage{msgs[0], msgs[2]}
+	deliveries, err := c.deliveries(claimed)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{msgs[0].ID: 1, msgs[2].ID: 1}, deliveries)
+}
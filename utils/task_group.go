@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// PanicError 任务中发生的 panic，包含 panic 的值与调用栈
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %+v\n%s", e.Value, e.Stack)
+}
+
+// Unwrap panic 的值为 error 时返回该错误，便于通过 errors.Is 判断
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// TaskGroupOptions 任务组配置
+type TaskGroupOptions struct {
+	// Name 任务组名称，任务的 goroutine 以此命名
+	Name string
+	// Limit 同时执行的任务数上限，达到上限时 Go 阻塞等待，为0时不限制
+	Limit int
+	// CollectErrors 为 false 时第一个错误会结束任务组的 ctx 并作为 Wait 的返回值；
+	// 为 true 时所有任务都会执行，Wait 返回合并后的所有错误
+	CollectErrors bool
+	// Timeout 单个任务的执行时长，超时后结束任务的 ctx，为0时不限制
+	Timeout time.Duration
+}
+
+// TaskGroup 一组相关的任务，所有任务共享同一个 ctx，通过 Wait 等待全部结束
+type TaskGroup struct {
+	opts   TaskGroupOptions
+	ctx    context.Context
+	cancel context.CancelFunc
+	slots  chan struct{}
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewTaskGroup 创建任务组，返回的 ctx 在 parent 结束、Wait 返回或（非 CollectErrors 模式下）任一任务出错时结束
+func NewTaskGroup(parent context.Context, opts *TaskGroupOptions) (*TaskGroup, context.Context) {
+	g := &TaskGroup{}
+	if opts != nil {
+		g.opts = *opts
+	}
+	if g.opts.Name == "" {
+		g.opts.Name = "task-group"
+	}
+	if g.opts.Limit > 0 {
+		g.slots = make(chan struct{}, g.opts.Limit)
+	}
+	g.ctx, g.cancel = context.WithCancel(parent)
+	return g, g.ctx
+}
+
+// Go 在新的 goroutine 中执行任务，任务中的 panic 会被转换为 PanicError
+// 达到并发上限时阻塞等待，等待期间任务组的 ctx 结束时不再执行该任务
+func (g *TaskGroup) Go(f func(ctx context.Context) error) {
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		case <-g.ctx.Done():
+			g.fail(g.ctx.Err())
+			return
+		}
+	}
+
+	g.wg.Add(1)
+	defaultSupervisor.start(g.opts.Name, nil, func(context.Context) error {
+		defer g.wg.Done()
+		if g.slots != nil {
+			defer func() { <-g.slots }()
+		}
+		if err := g.call(f); err != nil {
+			g.fail(err)
+		}
+		return nil
+	})
+}
+
+// Wait 等待所有任务结束，返回第一个错误或合并后的所有错误
+func (g *TaskGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// call 执行任务，将任意值的 panic 转换为包含调用栈的 PanicError
+func (g *TaskGroup) call(f func(ctx context.Context) error) (err error) {
+	ctx := g.ctx
+	if g.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.opts.Timeout)
+		defer cancel()
+	}
+	defer func() {
+		if res := recover(); res != nil {
+			perr := &PanicError{Value: res, Stack: string(debug.Stack())}
+			GetLogger().Error("task panic",
+				zap.String("group", g.opts.Name),
+				zap.Any("panic", res),
+				zap.String("stack", perr.Stack),
+			)
+			err = perr
+		}
+	}()
+	return f(ctx)
+}
+
+// fail 记录任务的错误，非 CollectErrors 模式下只保留第一个错误并结束任务组的 ctx
+func (g *TaskGroup) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.opts.CollectErrors {
+		g.err = multierr.Append(g.err, err)
+		return
+	}
+	if g.err == nil {
+		g.err = err
+		g.cancel()
+	}
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/multierr"
+)
+
+func TestTaskGroupFirstError(t *testing.T) {
+	errTesting := errors.New("testing error")
+	g, ctx := NewTaskGroup(context.Background(), &TaskGroupOptions{Name: "testing:first"})
+	g.Go(func(context.Context) error {
+		return errTesting
+	})
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.Equal(t, errTesting, g.Wait())
+	assert.NotNil(t, ctx.Err())
+}
+
+func TestTaskGroupCollectErrors(t *testing.T) {
+	var done int32
+	g, _ := NewTaskGroup(context.Background(), &TaskGroupOptions{CollectErrors: true})
+	g.Go(func(context.Context) error {
+		return errors.New("error 1")
+	})
+	g.Go(func(context.Context) error {
+		panic("testing panic")
+	})
+	g.Go(func(context.Context) error {
+		atomic.AddInt32(&done, 1)
+		return nil
+	})
+
+	errs := multierr.Errors(g.Wait())
+	assert.Len(t, errs, 2)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&done))
+
+	var perr *PanicError
+	for _, err := range errs {
+		if errors.As(err, &perr) {
+			break
+		}
+	}
+	if assert.NotNil(t, perr) {
+		assert.Equal(t, "testing panic", perr.Value)
+		assert.Contains(t, perr.Stack, "task_group_test.go")
+	}
+}
+
+func TestTaskGroupLimit(t *testing.T) {
+	var running, peak int32
+	g, _ := NewTaskGroup(context.Background(), &TaskGroupOptions{Limit: 2})
+	for i := 0; i < 6; i++ {
+		g.Go(func(context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+
+	assert.Nil(t, g.Wait())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
+
+func TestTaskGroupTimeout(t *testing.T) {
+	g, _ := NewTaskGroup(context.Background(), &TaskGroupOptions{Timeout: 10 * time.Millisecond})
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.True(t, errors.Is(g.Wait(), context.DeadlineExceeded))
+}